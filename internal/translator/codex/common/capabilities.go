@@ -0,0 +1,145 @@
+package common
+
+import (
+	"sort"
+	"strings"
+
+	"github.com/router-for-me/CLIProxyAPI/v6/internal/constant"
+)
+
+// ModelCapabilities describes optional request features a Codex backend model accepts.
+// Features not listed are stripped from translated requests.
+type ModelCapabilities struct {
+	// AudioOutput reports whether the model can produce audio output.
+	AudioOutput bool
+
+	// MaxToolCalls reports whether the model honors a max_tool_calls budget.
+	MaxToolCalls bool
+}
+
+// modelCapabilities maps model name prefixes to their capabilities. The longest matching
+// prefix wins, so specific variants can override a family entry.
+var modelCapabilities = map[string]ModelCapabilities{
+	"gpt-audio":            {AudioOutput: true},
+	"gpt-4o-audio-preview": {AudioOutput: true},
+	"gpt-5":                {MaxToolCalls: true},
+}
+
+// LookupCapabilities returns the capabilities for the given model name. Unknown models get the
+// zero value, which only allows features every Codex backend supports.
+func LookupCapabilities(modelName string) ModelCapabilities {
+	name := strings.ToLower(strings.TrimSpace(modelName))
+	var best ModelCapabilities
+	bestLen := -1
+	for prefix, caps := range modelCapabilities {
+		if strings.HasPrefix(name, prefix) && len(prefix) > bestLen {
+			best = caps
+			bestLen = len(prefix)
+		}
+	}
+	return best
+}
+
+// DefaultReasoningEffort returns the reasoning effort to use when a request does not set one.
+// defaults maps model name prefixes to efforts and the longest matching prefix wins, so
+// "gpt-5.2-mini" can default lower than "gpt-5.2". Models without an entry default to medium.
+func DefaultReasoningEffort(modelName string, defaults map[string]string) string {
+	name := strings.ToLower(strings.TrimSpace(modelName))
+	effort := "medium"
+	bestLen := -1
+	for prefix, e := range defaults {
+		if strings.HasPrefix(name, strings.ToLower(prefix)) && len(prefix) > bestLen {
+			effort = e
+			bestLen = len(prefix)
+		}
+	}
+	return effort
+}
+
+// reasoningEffortLevels maps the integer effort levels some clients send to the effort names.
+var reasoningEffortLevels = []string{"minimal", "low", "medium", "high"}
+
+// ReasoningEffortFromLevel maps an integer reasoning effort level (0-3) to its name. Numbers that
+// are not whole or out of range report false.
+func ReasoningEffortFromLevel(level float64) (string, bool) {
+	i := int(level)
+	if float64(i) != level || i < 0 || i >= len(reasoningEffortLevels) {
+		return "", false
+	}
+	return reasoningEffortLevels[i], true
+}
+
+// droppedFields is the single table of top-level request fields the translators do not forward
+// as-is. Fields mapped to true are rejected by every Codex backend, so both translators strip
+// them. The rest are Chat Completions fields the chat translator drops, overrides, or only
+// consults through an option.
+var droppedFields = map[string]bool{
+	"max_completion_tokens": true,
+	"max_output_tokens":     true,
+	"safety_identifier":     true,
+	"service_tier":          true,
+	"temperature":           true,
+	"top_p":                 true,
+	"user":                  true,
+	"frequency_penalty":     false,
+	"logit_bias":            false,
+	"max_tokens":            false,
+	"metadata":              false,
+	"n":                     false,
+	"parallel_tool_calls":   false,
+	"prediction":            false,
+	"presence_penalty":      false,
+	"prompt_cache_key":      false,
+	"seed":                  false,
+	"stop":                  false,
+	"store":                 false,
+	"stream_options":        false,
+	"web_search_options":    false,
+}
+
+// IsDroppedField reports whether the Chat Completions translator drops the top-level field name
+// instead of forwarding it.
+func IsDroppedField(name string) bool {
+	_, ok := droppedFields[name]
+	return ok
+}
+
+// RejectedFields returns, in sorted order, the top-level request fields no Codex backend accepts.
+func RejectedFields() []string {
+	var fields []string
+	for name, rejected := range droppedFields {
+		if rejected {
+			fields = append(fields, name)
+		}
+	}
+	sort.Strings(fields)
+	return fields
+}
+
+// UnsupportedFields returns, in sorted order, the top-level request fields the translator for
+// the given source format strips for the given model. The Chat Completions translator
+// (constant.OpenAI) drops every field in the dropped field table, while the Responses translator
+// (constant.OpenaiResponse) only drops the fields no Codex backend accepts. Both add the fields
+// gated on a capability the model lacks. Other formats report nil.
+func UnsupportedFields(format, modelName string) []string {
+	var fields []string
+	caps := LookupCapabilities(modelName)
+	switch format {
+	case constant.OpenAI:
+		for name := range droppedFields {
+			fields = append(fields, name)
+		}
+		if !caps.AudioOutput {
+			fields = append(fields, "audio", "modalities")
+		}
+	case constant.OpenaiResponse:
+		fields = RejectedFields()
+	default:
+		return nil
+	}
+	if !caps.MaxToolCalls {
+		fields = append(fields, "max_tool_calls")
+	}
+	sort.Strings(fields)
+	return fields
+}
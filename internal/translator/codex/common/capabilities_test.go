@@ -0,0 +1,96 @@
+package common
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/router-for-me/CLIProxyAPI/v6/internal/constant"
+)
+
+// TestLookupCapabilities tests prefix matching against the capability table
+func TestLookupCapabilities(t *testing.T) {
+	if !LookupCapabilities("gpt-audio-2025-08-28").AudioOutput {
+		t.Error("Expected gpt-audio variants to support audio output")
+	}
+	if LookupCapabilities("gpt-5.2").AudioOutput {
+		t.Error("Expected gpt-5.2 not to support audio output")
+	}
+	if !LookupCapabilities("gpt-5.2-codex").MaxToolCalls {
+		t.Error("Expected gpt-5 variants to support max_tool_calls")
+	}
+	if LookupCapabilities("gpt-audio").MaxToolCalls {
+		t.Error("Expected gpt-audio not to support max_tool_calls")
+	}
+}
+
+// TestUnsupportedFields tests that each source format reports what its translator drops and that
+// capability-gated fields are only listed for models lacking them
+func TestUnsupportedFields(t *testing.T) {
+	capable := UnsupportedFields(constant.OpenAI, "gpt-5.2")
+	expected := []string{"audio", "frequency_penalty", "logit_bias", "max_completion_tokens", "max_output_tokens", "max_tokens", "metadata", "modalities", "n", "parallel_tool_calls", "prediction", "presence_penalty", "prompt_cache_key", "safety_identifier", "seed", "service_tier", "stop", "store", "stream_options", "temperature", "top_p", "user", "web_search_options"}
+	if !reflect.DeepEqual(capable, expected) {
+		t.Errorf("Expected %v for gpt-5.2, got %v", expected, capable)
+	}
+
+	limited := UnsupportedFields(constant.OpenAI, "gpt-audio")
+	expected = []string{"frequency_penalty", "logit_bias", "max_completion_tokens", "max_output_tokens", "max_tokens", "max_tool_calls", "metadata", "n", "parallel_tool_calls", "prediction", "presence_penalty", "prompt_cache_key", "safety_identifier", "seed", "service_tier", "stop", "store", "stream_options", "temperature", "top_p", "user", "web_search_options"}
+	if !reflect.DeepEqual(limited, expected) {
+		t.Errorf("Expected %v for gpt-audio, got %v", expected, limited)
+	}
+
+	responses := UnsupportedFields(constant.OpenaiResponse, "gpt-audio")
+	expected = []string{"max_completion_tokens", "max_output_tokens", "max_tool_calls", "safety_identifier", "service_tier", "temperature", "top_p", "user"}
+	if !reflect.DeepEqual(responses, expected) {
+		t.Errorf("Expected %v for the Responses format, got %v", expected, responses)
+	}
+
+	if fields := UnsupportedFields("gemini", "gpt-5.2"); fields != nil {
+		t.Errorf("Expected nil for an untranslated format, got %v", fields)
+	}
+}
+
+// TestRejectedFields tests that only fields rejected by every backend are listed and that they
+// are part of the dropped field table
+func TestRejectedFields(t *testing.T) {
+	expected := []string{"max_completion_tokens", "max_output_tokens", "safety_identifier", "service_tier", "temperature", "top_p", "user"}
+	if got := RejectedFields(); !reflect.DeepEqual(got, expected) {
+		t.Errorf("Expected %v, got %v", expected, got)
+	}
+	for _, name := range expected {
+		if !IsDroppedField(name) {
+			t.Errorf("Expected %s to be a dropped field", name)
+		}
+	}
+	if IsDroppedField("messages") {
+		t.Error("Expected messages not to be a dropped field")
+	}
+}
+
+// TestDefaultReasoningEffort tests that the longest matching prefix picks the default effort
+func TestDefaultReasoningEffort(t *testing.T) {
+	defaults := map[string]string{"gpt-5.2": "high", "gpt-5.2-mini": "low"}
+	cases := map[string]string{
+		"gpt-5.2":      "high",
+		"gpt-5.2-mini": "low",
+		"gpt-5.1":      "medium",
+	}
+	for model, want := range cases {
+		if got := DefaultReasoningEffort(model, defaults); got != want {
+			t.Errorf("Expected %q for %s, got %q", want, model, got)
+		}
+	}
+}
+
+// TestReasoningEffortFromLevel tests the integer effort level mapping
+func TestReasoningEffortFromLevel(t *testing.T) {
+	for level, want := range []string{"minimal", "low", "medium", "high"} {
+		if got, ok := ReasoningEffortFromLevel(float64(level)); !ok || got != want {
+			t.Errorf("Expected %q for level %d, got %q", want, level, got)
+		}
+	}
+	for _, level := range []float64{-1, 4, 1.5} {
+		if _, ok := ReasoningEffortFromLevel(level); ok {
+			t.Errorf("Expected level %v to be rejected", level)
+		}
+	}
+}
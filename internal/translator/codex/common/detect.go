@@ -0,0 +1,37 @@
+package common
+
+import "github.com/tidwall/gjson"
+
+// IsCodexRequest reports whether rawJSON already looks like a translated Codex request, so callers
+// can skip translating it a second time. Every Codex translator emits an input array with
+// store:false and "reasoning.encrypted_content" in include, and rewrites system roles to
+// developer; a payload carrying all of these markers and no Chat Completions messages is treated
+// as already converted.
+func IsCodexRequest(rawJSON []byte) bool {
+	if !gjson.ValidBytes(rawJSON) {
+		return false
+	}
+	root := gjson.ParseBytes(rawJSON)
+	if !root.IsObject() || root.Get("messages").Exists() || !root.Get("input").IsArray() {
+		return false
+	}
+	if store := root.Get("store"); store.Type != gjson.False {
+		return false
+	}
+	encrypted := false
+	for _, v := range root.Get("include").Array() {
+		if v.String() == "reasoning.encrypted_content" {
+			encrypted = true
+			break
+		}
+	}
+	if !encrypted {
+		return false
+	}
+	for _, item := range root.Get("input").Array() {
+		if item.Get("role").String() == "system" {
+			return false
+		}
+	}
+	return true
+}
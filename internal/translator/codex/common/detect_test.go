@@ -0,0 +1,43 @@
+package common
+
+import "testing"
+
+// TestIsCodexRequest tests that translated Codex payloads are recognized and client payloads are not
+func TestIsCodexRequest(t *testing.T) {
+	cases := []struct {
+		name string
+		in   string
+		want bool
+	}{
+		{
+			name: "codex payload",
+			in:   `{"model":"gpt-5.2","stream":true,"store":false,"include":["reasoning.encrypted_content"],"input":[{"type":"message","role":"developer","content":[{"type":"input_text","text":"Be brief"}]}]}`,
+			want: true,
+		},
+		{
+			name: "chat completions payload",
+			in:   `{"model":"gpt-5.2","messages":[{"role":"system","content":"Be brief"},{"role":"user","content":"Hi"}]}`,
+			want: false,
+		},
+		{
+			name: "responses payload with system role",
+			in:   `{"model":"gpt-5.2","store":false,"include":["reasoning.encrypted_content"],"input":[{"type":"message","role":"system","content":"Be brief"}]}`,
+			want: false,
+		},
+		{
+			name: "responses payload without include",
+			in:   `{"model":"gpt-5.2","store":false,"input":[]}`,
+			want: false,
+		},
+		{
+			name: "invalid json",
+			in:   `{"input":`,
+			want: false,
+		},
+	}
+	for _, tc := range cases {
+		if got := IsCodexRequest([]byte(tc.in)); got != tc.want {
+			t.Errorf("%s: expected %v, got %v", tc.name, tc.want, got)
+		}
+	}
+}
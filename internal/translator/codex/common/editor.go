@@ -0,0 +1,96 @@
+package common
+
+import (
+	"fmt"
+
+	"github.com/tidwall/gjson"
+	"github.com/tidwall/sjson"
+)
+
+// JSONEditor applies sjson edits while remembering the first failure. A failed edit leaves the
+// document unchanged, so the translators never continue from a half-applied state, and the
+// recorded error lets strict callers reject the request instead of forwarding it.
+type JSONEditor struct {
+	err error
+}
+
+// Set applies sjson.Set to doc, returning doc unchanged when the edit fails.
+func (e *JSONEditor) Set(doc, path string, value any) string {
+	updated, err := sjson.Set(doc, path, value)
+	if err != nil {
+		e.record(fmt.Errorf("set %s: %w", path, err))
+		return doc
+	}
+	return updated
+}
+
+// SetRaw applies sjson.SetRaw to doc. The raw value must itself be valid JSON because sjson
+// splices it in verbatim; invalid values are rejected and doc is returned unchanged.
+func (e *JSONEditor) SetRaw(doc, path, raw string) string {
+	if !gjson.Valid(raw) {
+		e.record(fmt.Errorf("set %s: value is not valid JSON", path))
+		return doc
+	}
+	updated, err := sjson.SetRaw(doc, path, raw)
+	if err != nil {
+		e.record(fmt.Errorf("set %s: %w", path, err))
+		return doc
+	}
+	return updated
+}
+
+// SetBytes applies sjson.SetBytes to doc, returning doc unchanged when the edit fails.
+func (e *JSONEditor) SetBytes(doc []byte, path string, value any) []byte {
+	updated, err := sjson.SetBytes(doc, path, value)
+	if err != nil {
+		e.record(fmt.Errorf("set %s: %w", path, err))
+		return doc
+	}
+	return updated
+}
+
+// SetRawBytes applies sjson.SetRawBytes to doc with the same validation as SetRaw.
+func (e *JSONEditor) SetRawBytes(doc []byte, path string, raw []byte) []byte {
+	if !gjson.ValidBytes(raw) {
+		e.record(fmt.Errorf("set %s: value is not valid JSON", path))
+		return doc
+	}
+	updated, err := sjson.SetRawBytes(doc, path, raw)
+	if err != nil {
+		e.record(fmt.Errorf("set %s: %w", path, err))
+		return doc
+	}
+	return updated
+}
+
+// DeleteBytes applies sjson.DeleteBytes to doc, returning doc unchanged when the edit fails.
+func (e *JSONEditor) DeleteBytes(doc []byte, path string) []byte {
+	updated, err := sjson.DeleteBytes(doc, path)
+	if err != nil {
+		e.record(fmt.Errorf("delete %s: %w", path, err))
+		return doc
+	}
+	return updated
+}
+
+// Err returns the first edit failure, if any.
+func (e *JSONEditor) Err() error {
+	return e.err
+}
+
+// Finish returns the first edit failure, or an error when the final document is not valid JSON.
+func (e *JSONEditor) Finish(doc []byte) error {
+	if e.err != nil {
+		return e.err
+	}
+	if !gjson.ValidBytes(doc) {
+		return fmt.Errorf("translated request is not valid JSON")
+	}
+	return nil
+}
+
+func (e *JSONEditor) record(err error) {
+	if e.err == nil {
+		e.err = err
+	}
+}
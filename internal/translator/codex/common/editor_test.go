@@ -0,0 +1,43 @@
+package common
+
+import (
+	"testing"
+
+	"github.com/tidwall/gjson"
+)
+
+// TestJSONEditor_InvalidIntermediateState tests that a failing edit is recorded, leaves the
+// document untouched, and is still reported after later edits succeed
+func TestJSONEditor_InvalidIntermediateState(t *testing.T) {
+	var ed JSONEditor
+	doc := `{"model":"gpt-5.2"}`
+
+	doc = ed.SetRaw(doc, "tools", `[{"type":"function"`)
+	if doc != `{"model":"gpt-5.2"}` {
+		t.Fatalf("Expected document to be unchanged after invalid raw value, got %s", doc)
+	}
+	if ed.Err() == nil {
+		t.Fatal("Expected invalid raw value to be recorded")
+	}
+
+	doc = ed.Set(doc, "", true)
+	doc = ed.Set(doc, "store", false)
+	if !gjson.Valid(doc) || gjson.Get(doc, "store").Type != gjson.False {
+		t.Fatalf("Expected later edits to apply to the last consistent document, got %s", doc)
+	}
+
+	if err := ed.Finish([]byte(doc)); err == nil {
+		t.Error("Expected Finish to report the earlier failure")
+	}
+}
+
+// TestJSONEditor_FinishValidatesDocument tests that Finish rejects an invalid final document
+func TestJSONEditor_FinishValidatesDocument(t *testing.T) {
+	var ed JSONEditor
+	if err := ed.Finish([]byte(`{"input":[}`)); err == nil {
+		t.Error("Expected Finish to reject invalid JSON")
+	}
+	if err := ed.Finish([]byte(`{"input":[]}`)); err != nil {
+		t.Errorf("Expected valid document to pass, got %v", err)
+	}
+}
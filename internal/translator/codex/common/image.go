@@ -0,0 +1,17 @@
+package common
+
+import "strings"
+
+// DataURLSize returns the decoded size in bytes of a base64 data URL image. It reports false for
+// other URLs, whose size cannot be known without fetching them.
+func DataURLSize(url string) (int, bool) {
+	if !strings.HasPrefix(url, "data:") {
+		return 0, false
+	}
+	meta, data, ok := strings.Cut(url, ",")
+	if !ok || !strings.HasSuffix(meta, ";base64") {
+		return 0, false
+	}
+	data = strings.TrimRight(data, "=")
+	return len(data) * 3 / 4, true
+}
@@ -0,0 +1,13 @@
+package common
+
+import "testing"
+
+// TestDataURLSize tests the decoded size of base64 data URLs
+func TestDataURLSize(t *testing.T) {
+	if n, ok := DataURLSize("data:image/png;base64,aGVsbG8="); !ok || n != 5 {
+		t.Errorf("Expected 5 bytes, got %d (%v)", n, ok)
+	}
+	if _, ok := DataURLSize("https://example.com/a.png"); ok {
+		t.Error("Expected remote URLs to have no known size")
+	}
+}
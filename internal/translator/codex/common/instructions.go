@@ -0,0 +1,16 @@
+package common
+
+import "strings"
+
+// PrefixInstructions returns instructions with prefix prepended, separated by a blank line.
+// Instructions that already start with prefix, for example because a client replayed the
+// instructions of an earlier turn, are returned unchanged so the prefix never repeats.
+func PrefixInstructions(prefix, instructions string) string {
+	if prefix == "" || strings.HasPrefix(instructions, prefix) {
+		return instructions
+	}
+	if instructions == "" {
+		return prefix
+	}
+	return prefix + "\n\n" + instructions
+}
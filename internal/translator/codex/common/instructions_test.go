@@ -0,0 +1,20 @@
+package common
+
+import "testing"
+
+// TestPrefixInstructions tests that the prefix is prepended once
+func TestPrefixInstructions(t *testing.T) {
+	cases := []struct {
+		instructions string
+		want         string
+	}{
+		{"", "You are Codex."},
+		{"Be brief.", "You are Codex.\n\nBe brief."},
+		{"You are Codex.\n\nBe brief.", "You are Codex.\n\nBe brief."},
+	}
+	for _, tc := range cases {
+		if got := PrefixInstructions("You are Codex.", tc.instructions); got != tc.want {
+			t.Errorf("Expected %q for %q, got %q", tc.want, tc.instructions, got)
+		}
+	}
+}
@@ -0,0 +1,34 @@
+package common
+
+import "strings"
+
+// ModelNameNormalization configures how client-supplied model names are rewritten before
+// they are placed in a Codex request. The zero value leaves names untouched.
+type ModelNameNormalization struct {
+	// StripProviderPrefix removes a leading provider segment such as "openai/" from
+	// names like "openai/gpt-5.2".
+	StripProviderPrefix bool
+
+	// Aliases maps model names, after any prefix stripping, to the name sent to Codex.
+	// Lookups are case-insensitive.
+	Aliases map[string]string
+}
+
+// NormalizeModelName applies n to modelName and returns the name to forward.
+func NormalizeModelName(modelName string, n ModelNameNormalization) string {
+	name := strings.TrimSpace(modelName)
+	if n.StripProviderPrefix {
+		if idx := strings.LastIndex(name, "/"); idx >= 0 && idx < len(name)-1 {
+			name = name[idx+1:]
+		}
+	}
+	for alias, target := range n.Aliases {
+		if strings.EqualFold(alias, name) {
+			return target
+		}
+	}
+	if name == strings.TrimSpace(modelName) {
+		return modelName
+	}
+	return name
+}
@@ -0,0 +1,29 @@
+package common
+
+import "testing"
+
+// TestNormalizeModelName tests provider prefix stripping and alias mapping
+func TestNormalizeModelName(t *testing.T) {
+	n := ModelNameNormalization{
+		StripProviderPrefix: true,
+		Aliases:             map[string]string{"gpt-latest": "gpt-5.2"},
+	}
+	cases := []struct {
+		in   string
+		want string
+	}{
+		{"gpt-5.2", "gpt-5.2"},
+		{"openai/gpt-5.2", "gpt-5.2"},
+		{"openai/GPT-Latest", "gpt-5.2"},
+		{"gpt-latest", "gpt-5.2"},
+	}
+	for _, tc := range cases {
+		if got := NormalizeModelName(tc.in, n); got != tc.want {
+			t.Errorf("NormalizeModelName(%q): expected %q, got %q", tc.in, tc.want, got)
+		}
+	}
+
+	if got := NormalizeModelName("openai/gpt-5.2", ModelNameNormalization{}); got != "openai/gpt-5.2" {
+		t.Errorf("Expected the zero value to leave names untouched, got %q", got)
+	}
+}
@@ -0,0 +1,31 @@
+package common
+
+import (
+	"github.com/tidwall/gjson"
+	"github.com/tidwall/sjson"
+)
+
+// DropNullFields removes top-level fields whose value is an explicit JSON null. Clients send
+// "tool_choice": null and similar to mean "not set", and the translators treat those fields as
+// if they were omitted. rawJSON is returned as-is when it holds no null fields.
+func DropNullFields(rawJSON []byte) []byte {
+	var nullKeys []string
+	gjson.ParseBytes(rawJSON).ForEach(func(key, value gjson.Result) bool {
+		if value.Type == gjson.Null {
+			nullKeys = append(nullKeys, key.String())
+		}
+		return true
+	})
+	for _, key := range nullKeys {
+		if updated, err := sjson.DeleteBytes(rawJSON, EscapePathKey(key)); err == nil {
+			rawJSON = updated
+		}
+	}
+	return rawJSON
+}
+
+// EscapePathKey escapes the gjson/sjson path syntax characters in a single object key so it
+// can be used as a path.
+func EscapePathKey(key string) string {
+	return gjsonEscape(key)
+}
@@ -0,0 +1,23 @@
+package common
+
+import (
+	"testing"
+
+	"github.com/tidwall/gjson"
+)
+
+// TestDropNullFields tests that only top-level null fields are removed
+func TestDropNullFields(t *testing.T) {
+	input := []byte(`{"tool_choice":null,"a.b":null,"text":{"verbosity":null},"model":"gpt-5.2"}`)
+	output := DropNullFields(input)
+
+	if gjson.GetBytes(output, "tool_choice").Exists() || gjson.GetBytes(output, `a\.b`).Exists() {
+		t.Errorf("Expected top-level null fields to be removed, got %s", output)
+	}
+	if !gjson.GetBytes(output, "text.verbosity").Exists() {
+		t.Errorf("Expected nested null fields to be kept, got %s", output)
+	}
+	if got := gjson.GetBytes(output, "model").String(); got != "gpt-5.2" {
+		t.Errorf("Expected model to be kept, got %q", got)
+	}
+}
@@ -0,0 +1,246 @@
+// Package common provides helpers shared by the request translators that target
+// the Codex (OpenAI Responses) upstream.
+package common
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/tidwall/gjson"
+)
+
+// ValidateAgainstSchema checks a produced Codex request against a JSON schema.
+// Only the subset of JSON Schema needed to express API contracts is supported:
+// type, enum, const, required, properties, additionalProperties, items,
+// minItems/maxItems, minLength/maxLength and minimum/maximum. Unknown keywords
+// are ignored so that richer schemas still validate the parts we understand.
+//
+// Parameters:
+//   - out: The translated request JSON to validate
+//   - schema: The JSON schema describing the expected request shape
+//
+// Returns:
+//   - error: A descriptive error for the first violation found, or nil
+func ValidateAgainstSchema(out []byte, schema []byte) error {
+	if !gjson.ValidBytes(schema) {
+		return fmt.Errorf("schema is not valid JSON")
+	}
+	if !gjson.ValidBytes(out) {
+		return fmt.Errorf("output is not valid JSON")
+	}
+	return validateNode(gjson.ParseBytes(out), gjson.ParseBytes(schema), "$")
+}
+
+func validateNode(value, schema gjson.Result, path string) error {
+	if schema.Type == gjson.True {
+		return nil
+	}
+	if schema.Type == gjson.False {
+		return fmt.Errorf("%s: value not allowed by schema", path)
+	}
+	if !schema.IsObject() {
+		return nil
+	}
+
+	if t := schema.Get("type"); t.Exists() {
+		var allowed []string
+		if t.IsArray() {
+			for _, item := range t.Array() {
+				allowed = append(allowed, item.String())
+			}
+		} else {
+			allowed = append(allowed, t.String())
+		}
+		matched := false
+		for _, a := range allowed {
+			if schemaTypeMatches(value, a) {
+				matched = true
+				break
+			}
+		}
+		if !matched {
+			return fmt.Errorf("%s: expected type %s, got %s", path, strings.Join(allowed, "|"), jsonTypeName(value))
+		}
+	}
+
+	if c := schema.Get("const"); c.Exists() {
+		if !jsonEqual(value, c) {
+			return fmt.Errorf("%s: expected constant %s", path, c.Raw)
+		}
+	}
+
+	if enum := schema.Get("enum"); enum.IsArray() {
+		found := false
+		for _, candidate := range enum.Array() {
+			if jsonEqual(value, candidate) {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return fmt.Errorf("%s: value %s is not one of %s", path, value.Raw, enum.Raw)
+		}
+	}
+
+	switch {
+	case value.IsObject():
+		return validateObject(value, schema, path)
+	case value.IsArray():
+		return validateArray(value, schema, path)
+	case value.Type == gjson.String:
+		n := len([]rune(value.String()))
+		if v := schema.Get("minLength"); v.Exists() && int64(n) < v.Int() {
+			return fmt.Errorf("%s: string shorter than %d", path, v.Int())
+		}
+		if v := schema.Get("maxLength"); v.Exists() && int64(n) > v.Int() {
+			return fmt.Errorf("%s: string longer than %d", path, v.Int())
+		}
+	case value.Type == gjson.Number:
+		if v := schema.Get("minimum"); v.Exists() && value.Float() < v.Float() {
+			return fmt.Errorf("%s: %s is less than minimum %s", path, value.Raw, v.Raw)
+		}
+		if v := schema.Get("maximum"); v.Exists() && value.Float() > v.Float() {
+			return fmt.Errorf("%s: %s is greater than maximum %s", path, value.Raw, v.Raw)
+		}
+	}
+	return nil
+}
+
+func validateObject(value, schema gjson.Result, path string) error {
+	if required := schema.Get("required"); required.IsArray() {
+		for _, key := range required.Array() {
+			if !value.Get(gjsonEscape(key.String())).Exists() {
+				return fmt.Errorf("%s: missing required field %q", path, key.String())
+			}
+		}
+	}
+
+	properties := schema.Get("properties")
+	additional := schema.Get("additionalProperties")
+	var err error
+	value.ForEach(func(key, child gjson.Result) bool {
+		childPath := path + "." + key.String()
+		if prop := properties.Get(gjsonEscape(key.String())); prop.Exists() {
+			err = validateNode(child, prop, childPath)
+			return err == nil
+		}
+		if additional.Exists() {
+			if additional.Type == gjson.False {
+				err = fmt.Errorf("%s: unexpected field", childPath)
+				return false
+			}
+			err = validateNode(child, additional, childPath)
+		}
+		return err == nil
+	})
+	return err
+}
+
+func validateArray(value, schema gjson.Result, path string) error {
+	items := value.Array()
+	if v := schema.Get("minItems"); v.Exists() && int64(len(items)) < v.Int() {
+		return fmt.Errorf("%s: expected at least %d items, got %d", path, v.Int(), len(items))
+	}
+	if v := schema.Get("maxItems"); v.Exists() && int64(len(items)) > v.Int() {
+		return fmt.Errorf("%s: expected at most %d items, got %d", path, v.Int(), len(items))
+	}
+	itemSchema := schema.Get("items")
+	if !itemSchema.Exists() {
+		return nil
+	}
+	for i, item := range items {
+		if err := validateNode(item, itemSchema, path+"["+strconv.Itoa(i)+"]"); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func schemaTypeMatches(value gjson.Result, typ string) bool {
+	switch typ {
+	case "object":
+		return value.IsObject()
+	case "array":
+		return value.IsArray()
+	case "string":
+		return value.Type == gjson.String
+	case "number":
+		return value.Type == gjson.Number
+	case "integer":
+		return value.Type == gjson.Number && value.Float() == float64(int64(value.Float()))
+	case "boolean":
+		return value.Type == gjson.True || value.Type == gjson.False
+	case "null":
+		return value.Type == gjson.Null
+	}
+	return false
+}
+
+func jsonTypeName(value gjson.Result) string {
+	switch {
+	case value.IsObject():
+		return "object"
+	case value.IsArray():
+		return "array"
+	}
+	switch value.Type {
+	case gjson.String:
+		return "string"
+	case gjson.Number:
+		return "number"
+	case gjson.True, gjson.False:
+		return "boolean"
+	case gjson.Null:
+		return "null"
+	}
+	return "undefined"
+}
+
+// jsonEqual compares two JSON values structurally, ignoring formatting and key order.
+func jsonEqual(a, b gjson.Result) bool {
+	if jsonTypeName(a) != jsonTypeName(b) {
+		return false
+	}
+	switch {
+	case a.IsObject():
+		am, bm := a.Map(), b.Map()
+		if len(am) != len(bm) {
+			return false
+		}
+		for k, av := range am {
+			bv, ok := bm[k]
+			if !ok || !jsonEqual(av, bv) {
+				return false
+			}
+		}
+		return true
+	case a.IsArray():
+		aa, ba := a.Array(), b.Array()
+		if len(aa) != len(ba) {
+			return false
+		}
+		for i := range aa {
+			if !jsonEqual(aa[i], ba[i]) {
+				return false
+			}
+		}
+		return true
+	case a.Type == gjson.Number:
+		return a.Float() == b.Float()
+	}
+	return a.String() == b.String()
+}
+
+// gjsonEscape escapes gjson path metacharacters so a raw key can be used as a path.
+func gjsonEscape(key string) string {
+	var b strings.Builder
+	for _, r := range key {
+		switch r {
+		case '.', '*', '?', '|', '#', '@', '\\', '!', '=', '<', '>', '%':
+			b.WriteByte('\\')
+		}
+		b.WriteRune(r)
+	}
+	return b.String()
+}
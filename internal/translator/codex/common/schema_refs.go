@@ -0,0 +1,94 @@
+package common
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/tidwall/gjson"
+	"github.com/tidwall/sjson"
+)
+
+// InlineSchemaRefs replaces local "$ref" pointers into "$defs" (or the older "definitions") with
+// the referenced schema, for backends whose strict mode rejects references. Keywords placed next
+// to a "$ref" are kept on the inlined schema, and object key order is preserved. The definitions
+// are removed once every reference is inlined. Recursive or unresolvable references cannot be
+// flattened and are reported as errors.
+//
+// Parameters:
+//   - schema: The JSON schema, typically a function's parameters
+//
+// Returns:
+//   - []byte: The schema without local references
+//   - error: An error if the schema is invalid or a reference cannot be inlined
+func InlineSchemaRefs(schema []byte) ([]byte, error) {
+	if !gjson.ValidBytes(schema) {
+		return nil, fmt.Errorf("schema is not valid JSON")
+	}
+	root := gjson.ParseBytes(schema)
+	defs := map[string]gjson.Result{}
+	for _, key := range []string{"definitions", "$defs"} {
+		root.Get(gjsonEscape(key)).ForEach(func(name, def gjson.Result) bool {
+			defs["#/"+key+"/"+name.String()] = def
+			return true
+		})
+	}
+	if len(defs) == 0 {
+		return schema, nil
+	}
+	out, err := inlineSchemaNode(root, defs, map[string]bool{}, true)
+	if err != nil {
+		return nil, err
+	}
+	return []byte(out), nil
+}
+
+func inlineSchemaNode(node gjson.Result, defs map[string]gjson.Result, resolving map[string]bool, isRoot bool) (string, error) {
+	switch {
+	case node.IsObject():
+		out := `{}`
+		if ref := node.Get(gjsonEscape("$ref")); ref.Type == gjson.String {
+			pointer := strings.NewReplacer("~1", "/", "~0", "~").Replace(ref.String())
+			def, ok := defs[pointer]
+			if !ok {
+				return "", fmt.Errorf("unresolvable $ref %q", ref.String())
+			}
+			if resolving[pointer] {
+				return "", fmt.Errorf("recursive $ref %q cannot be inlined", ref.String())
+			}
+			resolving[pointer] = true
+			resolved, err := inlineSchemaNode(def, defs, resolving, false)
+			delete(resolving, pointer)
+			if err != nil {
+				return "", err
+			}
+			out = resolved
+		}
+		var err error
+		node.ForEach(func(key, child gjson.Result) bool {
+			name := key.String()
+			if name == "$ref" || (isRoot && (name == "$defs" || name == "definitions")) {
+				return true
+			}
+			var inlined string
+			if inlined, err = inlineSchemaNode(child, defs, resolving, false); err != nil {
+				return false
+			}
+			out, err = sjson.SetRaw(out, gjsonEscape(name), inlined)
+			return err == nil
+		})
+		return out, err
+	case node.IsArray():
+		out := `[]`
+		for _, child := range node.Array() {
+			inlined, err := inlineSchemaNode(child, defs, resolving, false)
+			if err != nil {
+				return "", err
+			}
+			if out, err = sjson.SetRaw(out, "-1", inlined); err != nil {
+				return "", err
+			}
+		}
+		return out, nil
+	}
+	return node.Raw, nil
+}
@@ -0,0 +1,49 @@
+package common
+
+import (
+	"testing"
+
+	"github.com/tidwall/gjson"
+)
+
+// TestInlineSchemaRefs tests that a $ref into $defs is replaced by the definition
+func TestInlineSchemaRefs(t *testing.T) {
+	schema := []byte(`{
+		"type": "object",
+		"properties": {
+			"home": {"$ref": "#/$defs/address", "description": "Home address"},
+			"tags": {"type": "array", "items": {"$ref": "#/$defs/tag"}}
+		},
+		"$defs": {
+			"address": {"type": "object", "properties": {"city": {"type": "string"}}},
+			"tag": {"type": "string"}
+		}
+	}`)
+
+	out, err := InlineSchemaRefs(schema)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	root := gjson.ParseBytes(out)
+	if root.Get(`\$defs`).Exists() {
+		t.Errorf("Expected $defs to be removed, got %s", out)
+	}
+	home := root.Get("properties.home")
+	if home.Get(`\$ref`).Exists() || home.Get("properties.city.type").String() != "string" {
+		t.Errorf("Expected the address definition to be inlined, got %s", home.Raw)
+	}
+	if got := home.Get("description").String(); got != "Home address" {
+		t.Errorf("Expected the sibling description to be kept, got %q", got)
+	}
+	if got := root.Get("properties.tags.items.type").String(); got != "string" {
+		t.Errorf("Expected the array items to be inlined, got %s", root.Get("properties.tags").Raw)
+	}
+}
+
+// TestInlineSchemaRefs_Recursive tests that recursive references are reported
+func TestInlineSchemaRefs_Recursive(t *testing.T) {
+	schema := []byte(`{"$ref": "#/$defs/node", "$defs": {"node": {"type": "object", "properties": {"next": {"$ref": "#/$defs/node"}}}}}`)
+	if _, err := InlineSchemaRefs(schema); err == nil {
+		t.Error("Expected a recursive schema to be rejected")
+	}
+}
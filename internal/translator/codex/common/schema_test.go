@@ -0,0 +1,72 @@
+package common
+
+import (
+	"strings"
+	"testing"
+)
+
+const codexRequestSchema = `{
+	"type": "object",
+	"required": ["model", "input", "stream", "store"],
+	"properties": {
+		"model": {"type": "string", "minLength": 1},
+		"stream": {"type": "boolean"},
+		"store": {"const": false},
+		"instructions": {"type": "string"},
+		"input": {
+			"type": "array",
+			"items": {
+				"type": "object",
+				"required": ["type"],
+				"properties": {
+					"type": {"enum": ["message", "function_call", "function_call_output", "reasoning"]},
+					"role": {"enum": ["user", "assistant", "developer"]}
+				}
+			}
+		}
+	}
+}`
+
+// TestValidateAgainstSchema_ConformingOutput verifies a well-formed Codex payload passes validation
+func TestValidateAgainstSchema_ConformingOutput(t *testing.T) {
+	out := []byte(`{
+		"instructions": "",
+		"stream": true,
+		"model": "gpt-5.2",
+		"input": [
+			{"type": "message", "role": "developer", "content": [{"type": "input_text", "text": "Be brief."}]},
+			{"type": "message", "role": "user", "content": [{"type": "input_text", "text": "Hello"}]}
+		],
+		"store": false
+	}`)
+
+	if err := ValidateAgainstSchema(out, []byte(codexRequestSchema)); err != nil {
+		t.Fatalf("Expected conforming output to validate, got error: %v", err)
+	}
+}
+
+// TestValidateAgainstSchema_BrokenOutput verifies violations are reported with their path
+func TestValidateAgainstSchema_BrokenOutput(t *testing.T) {
+	out := []byte(`{
+		"stream": true,
+		"model": "gpt-5.2",
+		"input": [
+			{"type": "message", "role": "system", "content": []}
+		],
+		"store": false
+	}`)
+
+	err := ValidateAgainstSchema(out, []byte(codexRequestSchema))
+	if err == nil {
+		t.Fatal("Expected validation error for system role, got nil")
+	}
+	if !strings.Contains(err.Error(), "$.input[0].role") {
+		t.Errorf("Expected error to reference $.input[0].role, got: %v", err)
+	}
+
+	missingModel := []byte(`{"stream": true, "input": [], "store": false}`)
+	err = ValidateAgainstSchema(missingModel, []byte(codexRequestSchema))
+	if err == nil || !strings.Contains(err.Error(), `"model"`) {
+		t.Errorf("Expected missing model error, got: %v", err)
+	}
+}
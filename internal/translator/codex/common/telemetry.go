@@ -0,0 +1,22 @@
+package common
+
+// Conversion events reported through Counters.
+const (
+	// EventToolNameShortened is reported for each tool name shortened to fit the Codex limit.
+	EventToolNameShortened = "tool_name_shortened"
+	// EventCallIDShortened is reported for each distinct tool call ID shortened to fit the Codex limit.
+	EventCallIDShortened = "call_id_shortened"
+	// EventFieldStripped is reported for each top-level request field dropped because Codex does not accept it.
+	EventFieldStripped = "field_stripped"
+	// EventToolDropped is reported for each declared tool dropped because Codex would reject it.
+	EventToolDropped = "tool_dropped"
+	// EventUnsupportedContentDropped is reported for each content part dropped because Codex cannot represent it.
+	EventUnsupportedContentDropped = "unsupported_content_dropped"
+)
+
+// Counters receives conversion events so callers can export them, for example as Prometheus
+// counters. Implementations must be safe for concurrent use when shared between requests.
+type Counters interface {
+	// Inc increments the counter for event by one.
+	Inc(event string)
+}
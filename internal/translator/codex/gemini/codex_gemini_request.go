@@ -35,7 +35,21 @@ import (
 //
 // Returns:
 //   - []byte: The transformed request data in Codex API format
-func ConvertGeminiRequestToCodex(modelName string, inputRawJSON []byte, _ bool) []byte {
+func ConvertGeminiRequestToCodex(modelName string, inputRawJSON []byte, stream bool) []byte {
+	return ConvertGeminiRequestToCodexWithOptions(modelName, inputRawJSON, stream, Options{})
+}
+
+// Options tunes how ConvertGeminiRequestToCodexWithOptions shapes the Codex request.
+// The zero value reproduces the behavior of ConvertGeminiRequestToCodex.
+type Options struct {
+	// SystemInstructionAsInstructions places the Gemini system instruction text in the top-level
+	// Codex "instructions" field instead of a leading developer message.
+	SystemInstructionAsInstructions bool
+}
+
+// ConvertGeminiRequestToCodexWithOptions performs the same conversion as
+// ConvertGeminiRequestToCodex while honoring the behavior switches in opts.
+func ConvertGeminiRequestToCodexWithOptions(modelName string, inputRawJSON []byte, _ bool, opts Options) []byte {
 	rawJSON := inputRawJSON
 	// Base template
 	out := `{"model":"","instructions":"","input":[]}`
@@ -84,21 +98,30 @@ func ConvertGeminiRequestToCodex(modelName string, inputRawJSON []byte, _ bool)
 	// Model
 	out, _ = sjson.Set(out, "model", modelName)
 
-	// System instruction -> as a user message with input_text parts
-	sysParts := root.Get("system_instruction.parts")
+	// System instruction -> a leading developer message with input_text parts, or the top-level
+	// instructions when requested. Gemini clients use both the REST (systemInstruction) and the
+	// snake_case (system_instruction) spelling.
+	sysParts := root.Get("systemInstruction.parts")
+	if !sysParts.Exists() {
+		sysParts = root.Get("system_instruction.parts")
+	}
 	if sysParts.IsArray() {
 		msg := `{"type":"message","role":"developer","content":[]}`
+		var texts []string
 		arr := sysParts.Array()
 		for i := 0; i < len(arr); i++ {
 			p := arr[i]
 			if t := p.Get("text"); t.Exists() {
+				texts = append(texts, t.String())
 				part := `{}`
 				part, _ = sjson.Set(part, "type", "input_text")
 				part, _ = sjson.Set(part, "text", t.String())
 				msg, _ = sjson.SetRaw(msg, "content.-1", part)
 			}
 		}
-		if len(gjson.Get(msg, "content").Array()) > 0 {
+		if opts.SystemInstructionAsInstructions {
+			out, _ = sjson.Set(out, "instructions", strings.Join(texts, "\n"))
+		} else if len(gjson.Get(msg, "content").Array()) > 0 {
 			out, _ = sjson.SetRaw(out, "input.-1", msg)
 		}
 	}
@@ -0,0 +1,37 @@
+package gemini
+
+import (
+	"testing"
+
+	"github.com/tidwall/gjson"
+)
+
+// TestConvertGeminiRequestToCodex_SystemInstruction tests that a Gemini systemInstruction becomes a
+// leading developer message by default and the instructions field when configured
+func TestConvertGeminiRequestToCodex_SystemInstruction(t *testing.T) {
+	inputJSON := []byte(`{
+		"systemInstruction": {"parts": [{"text": "You are a pirate."}, {"text": "Keep it short."}]},
+		"contents": [{"role": "user", "parts": [{"text": "Say hello."}]}]
+	}`)
+
+	output := ConvertGeminiRequestToCodex("gpt-5.2", inputJSON, false)
+
+	developer := gjson.GetBytes(output, "input.0")
+	if got := developer.Get("role").String(); got != "developer" {
+		t.Fatalf("Expected leading developer message, got %s", developer.Raw)
+	}
+	if got := developer.Get("content.0.text").String(); got != "You are a pirate." {
+		t.Errorf("Expected first system part text, got %q", got)
+	}
+	if got := developer.Get("content.1.text").String(); got != "Keep it short." {
+		t.Errorf("Expected second system part text, got %q", got)
+	}
+
+	output = ConvertGeminiRequestToCodexWithOptions("gpt-5.2", inputJSON, false, Options{SystemInstructionAsInstructions: true})
+	if got := gjson.GetBytes(output, "instructions").String(); got != "You are a pirate.\nKeep it short." {
+		t.Errorf("Expected system instruction in instructions, got %q", got)
+	}
+	if got := gjson.GetBytes(output, "input.0.role").String(); got != "user" {
+		t.Errorf("Expected no developer message when using instructions, got first role %q", got)
+	}
+}
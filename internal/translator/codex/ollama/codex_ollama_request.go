@@ -0,0 +1,133 @@
+// Package ollama provides request translation from the Ollama /api/chat format into the Codex
+// (OpenAI Responses) format. Requests are first rewritten into the Chat Completions shape and
+// then converted by the chat-completions translator, so tool name shortening, call ID handling
+// and image mapping behave exactly as they do for OpenAI clients.
+package ollama
+
+import (
+	"strings"
+
+	chatcompletions "github.com/router-for-me/CLIProxyAPI/v6/internal/translator/codex/openai/chat-completions"
+	log "github.com/sirupsen/logrus"
+	"github.com/tidwall/gjson"
+	"github.com/tidwall/sjson"
+)
+
+// ConvertOllamaRequestToCodex converts an Ollama /api/chat request JSON into an OpenAI Responses
+// API request JSON. Messages keep their roles; base64 "images" become image parts; tool calls,
+// whose arguments Ollama sends as objects, become function calls. From the "options" map,
+// num_predict is forwarded as max_output_tokens and seed as seed; the other options, including
+// stop, have no Codex equivalent and are dropped. A JSON schema "format" becomes a structured
+// output format.
+//
+// Parameters:
+//   - modelName: The name of the model to use for the request
+//   - rawJSON: The raw JSON request data in Ollama chat format
+//   - stream: A boolean indicating if the request is for a streaming response
+//
+// Returns:
+//   - []byte: The transformed request data in OpenAI Responses API format
+func ConvertOllamaRequestToCodex(modelName string, inputRawJSON []byte, stream bool) []byte {
+	chatJSON := ollamaToChatRequest(inputRawJSON)
+	opts := chatcompletions.Options{
+		ForwardMaxOutputTokens: true,
+		ForwardSeed:            gjson.GetBytes(chatJSON, "seed").Exists(),
+	}
+	if out, err := chatcompletions.ConvertOpenAIRequestToCodexWithOptions(modelName, chatJSON, stream, opts); err == nil {
+		return out
+	}
+	// Requests the strict conversion rejects are repaired instead, as for OpenAI clients.
+	return chatcompletions.ConvertOpenAIRequestToCodex(modelName, chatJSON, stream)
+}
+
+// ollamaToChatRequest rewrites an Ollama chat request into the Chat Completions shape.
+func ollamaToChatRequest(rawJSON []byte) []byte {
+	root := gjson.ParseBytes(rawJSON)
+	out := `{"messages":[]}`
+	if v := root.Get("model"); v.Exists() {
+		out, _ = sjson.Set(out, "model", v.String())
+	}
+
+	for _, m := range root.Get("messages").Array() {
+		msg := `{}`
+		msg, _ = sjson.Set(msg, "role", m.Get("role").String())
+		images := m.Get("images").Array()
+		if len(images) == 0 {
+			msg, _ = sjson.Set(msg, "content", m.Get("content").String())
+		} else {
+			content := `[]`
+			if text := m.Get("content").String(); text != "" {
+				part, _ := sjson.Set(`{"type":"text"}`, "text", text)
+				content, _ = sjson.SetRaw(content, "-1", part)
+			}
+			for _, img := range images {
+				part, _ := sjson.Set(`{"type":"image_url"}`, "image_url.url", imageDataURL(img.String()))
+				content, _ = sjson.SetRaw(content, "-1", part)
+			}
+			msg, _ = sjson.SetRaw(msg, "content", content)
+		}
+		// Ollama tool calls carry no id; the chat-completions translator synthesizes ids and
+		// pairs the following tool results with them in order.
+		for _, tc := range m.Get("tool_calls").Array() {
+			call := `{"type":"function"}`
+			call, _ = sjson.Set(call, "function.name", tc.Get("function.name").String())
+			call, _ = sjson.SetRaw(call, "function.arguments", argumentsRaw(tc.Get("function.arguments")))
+			msg, _ = sjson.SetRaw(msg, "tool_calls.-1", call)
+		}
+		out, _ = sjson.SetRaw(out, "messages.-1", msg)
+	}
+
+	if tools := root.Get("tools"); tools.IsArray() {
+		out, _ = sjson.SetRaw(out, "tools", tools.Raw)
+	}
+
+	options := root.Get("options")
+	if v := options.Get("num_predict"); v.Type == gjson.Number && v.Int() > 0 {
+		out, _ = sjson.Set(out, "max_tokens", v.Int())
+	}
+	if v := options.Get("seed"); v.Type == gjson.Number {
+		out, _ = sjson.Set(out, "seed", v.Int())
+	}
+
+	switch format := root.Get("format"); {
+	case format.IsObject():
+		rf, _ := sjson.SetRaw(`{"type":"json_schema","json_schema":{"name":"response"}}`, "json_schema.schema", format.Raw)
+		out, _ = sjson.SetRaw(out, "response_format", rf)
+	case format.Exists():
+		log.Debugf("codex translator: dropping unsupported Ollama format %s", format.Raw)
+	}
+
+	// Newer Ollama versions accept an effort level in "think"; booleans keep the default effort.
+	if think := root.Get("think"); think.Type == gjson.String {
+		out, _ = sjson.Set(out, "reasoning_effort", think.String())
+	}
+	return []byte(out)
+}
+
+// argumentsRaw returns tool call arguments as a JSON value the chat-completions translator
+// accepts: objects as-is and anything else as a string.
+func argumentsRaw(args gjson.Result) string {
+	if args.IsObject() {
+		return args.Raw
+	}
+	raw, _ := sjson.Set(`{}`, "v", args.String())
+	return gjson.Get(raw, "v").Raw
+}
+
+// imageDataURL wraps a raw base64 image from Ollama's images array in a data URL. Ollama does
+// not send a media type, so it is inferred from the leading bytes of the encoded data.
+func imageDataURL(data string) string {
+	if strings.HasPrefix(data, "data:") {
+		return data
+	}
+	mime := "image/png"
+	switch {
+	case strings.HasPrefix(data, "/9j/"):
+		mime = "image/jpeg"
+	case strings.HasPrefix(data, "R0lGOD"):
+		mime = "image/gif"
+	case strings.HasPrefix(data, "UklGR"):
+		mime = "image/webp"
+	}
+	return "data:" + mime + ";base64," + data
+}
@@ -0,0 +1,104 @@
+package ollama
+
+import (
+	"testing"
+
+	"github.com/tidwall/gjson"
+)
+
+// TestConvertOllamaRequestToCodex_TextTurn tests that a text conversation with options is converted
+func TestConvertOllamaRequestToCodex_TextTurn(t *testing.T) {
+	inputJSON := []byte(`{
+		"model": "gpt-5.2",
+		"messages": [
+			{"role": "system", "content": "Be brief."},
+			{"role": "user", "content": "Hi"}
+		],
+		"options": {"temperature": 0.1, "num_predict": 128, "seed": 42, "stop": ["END"]}
+	}`)
+
+	output := ConvertOllamaRequestToCodex("gpt-5.2", inputJSON, true)
+
+	if got := gjson.GetBytes(output, "model").String(); got != "gpt-5.2" {
+		t.Errorf("Expected model gpt-5.2, got %q", got)
+	}
+	input := gjson.GetBytes(output, "input").Array()
+	if len(input) != 2 {
+		t.Fatalf("Expected 2 input items, got %s", gjson.GetBytes(output, "input").Raw)
+	}
+	if input[0].Get("role").String() != "developer" || input[0].Get("content.0.text").String() != "Be brief." {
+		t.Errorf("Expected the system message as a developer message, got %s", input[0].Raw)
+	}
+	if input[1].Get("role").String() != "user" || input[1].Get("content.0.text").String() != "Hi" {
+		t.Errorf("Expected the user text, got %s", input[1].Raw)
+	}
+	if got := gjson.GetBytes(output, "max_output_tokens").Int(); got != 128 {
+		t.Errorf("Expected num_predict as max_output_tokens 128, got %d", got)
+	}
+	if got := gjson.GetBytes(output, "seed").Int(); got != 42 {
+		t.Errorf("Expected seed 42, got %d", got)
+	}
+	for _, field := range []string{"temperature", "stop", "options"} {
+		if gjson.GetBytes(output, field).Exists() {
+			t.Errorf("Expected %s to be stripped, got %s", field, output)
+		}
+	}
+}
+
+// TestConvertOllamaRequestToCodex_ImageTurn tests that base64 images become input_image parts with
+// an inferred media type
+func TestConvertOllamaRequestToCodex_ImageTurn(t *testing.T) {
+	inputJSON := []byte(`{
+		"model": "gpt-5.2",
+		"messages": [{"role": "user", "content": "What is this?", "images": ["iVBORw0KGgo=", "/9j/4AAQSkZJRg=="]}]
+	}`)
+
+	output := ConvertOllamaRequestToCodex("gpt-5.2", inputJSON, false)
+
+	parts := gjson.GetBytes(output, "input.0.content").Array()
+	if len(parts) != 3 {
+		t.Fatalf("Expected a text part and 2 images, got %s", gjson.GetBytes(output, "input.0.content").Raw)
+	}
+	if parts[0].Get("type").String() != "input_text" || parts[0].Get("text").String() != "What is this?" {
+		t.Errorf("Expected the text part first, got %s", parts[0].Raw)
+	}
+	if got := parts[1].Get("image_url").String(); got != "data:image/png;base64,iVBORw0KGgo=" {
+		t.Errorf("Expected a PNG data URL, got %q", got)
+	}
+	if got := parts[2].Get("image_url").String(); got != "data:image/jpeg;base64,/9j/4AAQSkZJRg==" {
+		t.Errorf("Expected a JPEG data URL, got %q", got)
+	}
+}
+
+// TestConvertOllamaRequestToCodex_ToolCallRoundTrip tests that object arguments are serialized and the
+// tool result is paired with the synthesized call ID
+func TestConvertOllamaRequestToCodex_ToolCallRoundTrip(t *testing.T) {
+	inputJSON := []byte(`{
+		"model": "gpt-5.2",
+		"messages": [
+			{"role": "user", "content": "Weather?"},
+			{"role": "assistant", "content": "", "tool_calls": [{"function": {"name": "get_weather", "arguments": {"city": "Paris"}}}]},
+			{"role": "tool", "content": "Sunny", "tool_name": "get_weather"}
+		],
+		"tools": [{"type": "function", "function": {"name": "get_weather", "parameters": {"type": "object"}}}]
+	}`)
+
+	output := ConvertOllamaRequestToCodex("gpt-5.2", inputJSON, false)
+
+	call := gjson.GetBytes(output, `input.#(type=="function_call")`)
+	result := gjson.GetBytes(output, `input.#(type=="function_call_output")`)
+	if got := call.Get("arguments").String(); got != `{"city":"Paris"}` {
+		t.Errorf("Expected serialized arguments, got %q", got)
+	}
+	if call.Get("call_id").String() == "" || call.Get("call_id").String() != result.Get("call_id").String() {
+		t.Errorf("Expected the tool result to pair with the call, got %s and %s", call.Raw, result.Raw)
+	}
+}
+
+// TestConvertOllamaRequestToCodex_NoSeed tests that no seed is sent when the options carry none
+func TestConvertOllamaRequestToCodex_NoSeed(t *testing.T) {
+	output := ConvertOllamaRequestToCodex("gpt-5.2", []byte(`{"model": "gpt-5.2", "messages": [{"role": "user", "content": "Hi"}]}`), false)
+	if gjson.GetBytes(output, "seed").Exists() || gjson.GetBytes(output, "max_output_tokens").Exists() {
+		t.Errorf("Expected no seed or max_output_tokens, got %s", output)
+	}
+}
@@ -0,0 +1,61 @@
+package chat_completions
+
+import (
+	"fmt"
+
+	"github.com/tidwall/gjson"
+	"github.com/tidwall/sjson"
+)
+
+// ConvertOpenAIBatchToCodex converts the lines of an OpenAI Batch API input file (JSONL of
+// {"custom_id", "method", "url", "body"} objects) into Codex batch lines. Each body is converted
+// with ConvertOpenAIRequestToCodexE using the model named in that body, and the envelope fields,
+// including custom_id, are preserved. Tool name and call ID shortening is computed per line, so
+// one request's tools never influence another's mapping. Every line must carry a string
+// custom_id, as the Batch API requires.
+//
+// Parameters:
+//   - lines: The batch lines, one JSON object per entry
+//
+// Returns:
+//   - [][]byte: The converted lines, in input order
+//   - error: An error naming the first line that could not be converted
+func ConvertOpenAIBatchToCodex(lines [][]byte) ([][]byte, error) {
+	out := make([][]byte, 0, len(lines))
+	for i, line := range lines {
+		if !gjson.ValidBytes(line) || !gjson.ParseBytes(line).IsObject() {
+			return nil, fmt.Errorf("batch line %d: not a JSON object", i)
+		}
+		customID := gjson.GetBytes(line, "custom_id")
+		if customID.Type != gjson.String {
+			return nil, fmt.Errorf("batch line %d: custom_id must be a string", i)
+		}
+		body := gjson.GetBytes(line, "body")
+		if !body.IsObject() {
+			return nil, fmt.Errorf("batch line %d: body must be a JSON object", i)
+		}
+
+		converted, err := ConvertOpenAIRequestToCodexE(body.Get("model").String(), []byte(body.Raw), false)
+		if err != nil {
+			return nil, fmt.Errorf("batch line %d: %w", i, err)
+		}
+
+		result, err := sjson.SetRawBytes([]byte(`{}`), "custom_id", []byte(customID.Raw))
+		if err == nil {
+			if method := gjson.GetBytes(line, "method"); method.Exists() {
+				result, err = sjson.SetRawBytes(result, "method", []byte(method.Raw))
+			}
+		}
+		if err == nil && gjson.GetBytes(line, "url").Exists() {
+			result, err = sjson.SetBytes(result, "url", "/v1/responses")
+		}
+		if err == nil {
+			result, err = sjson.SetRawBytes(result, "body", converted)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("batch line %d: %w", i, err)
+		}
+		out = append(out, result)
+	}
+	return out, nil
+}
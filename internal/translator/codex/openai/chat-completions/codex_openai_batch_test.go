@@ -0,0 +1,79 @@
+package chat_completions
+
+import (
+	"testing"
+
+	"github.com/tidwall/gjson"
+)
+
+// TestConvertOpenAIBatchToCodex_TwoLines tests that each batch line is converted on its own and
+// keeps its custom_id
+func TestConvertOpenAIBatchToCodex_TwoLines(t *testing.T) {
+	lines := [][]byte{
+		[]byte(`{"custom_id":"req-1","method":"POST","url":"/v1/chat/completions","body":{"model":"gpt-5","messages":[{"role":"user","content":"First"}]}}`),
+		[]byte(`{"custom_id":"req-2","method":"POST","url":"/v1/chat/completions","body":{"model":"gpt-5-codex","messages":[{"role":"user","content":"Second"}]}}`),
+	}
+
+	out, err := ConvertOpenAIBatchToCodex(lines)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if len(out) != 2 {
+		t.Fatalf("Expected 2 lines, got %d", len(out))
+	}
+
+	expected := []struct{ id, model, text string }{
+		{"req-1", "gpt-5", "First"},
+		{"req-2", "gpt-5-codex", "Second"},
+	}
+	for i, want := range expected {
+		line := gjson.ParseBytes(out[i])
+		if got := line.Get("custom_id").String(); got != want.id {
+			t.Errorf("Line %d: expected custom_id %q, got %q", i, want.id, got)
+		}
+		if got := line.Get("url").String(); got != "/v1/responses" {
+			t.Errorf("Line %d: expected url /v1/responses, got %q", i, got)
+		}
+		if got := line.Get("body.model").String(); got != want.model {
+			t.Errorf("Line %d: expected model %q, got %q", i, want.model, got)
+		}
+		if got := line.Get("body.input.0.content.0.text").String(); got != want.text {
+			t.Errorf("Line %d: expected input text %q, got %q", i, want.text, got)
+		}
+		if line.Get("body.messages").Exists() {
+			t.Errorf("Line %d: expected body to be converted, got %s", i, line.Get("body").Raw)
+		}
+	}
+}
+
+// TestConvertOpenAIBatchToCodex_ReportsLine tests that a line without a body is reported by index
+func TestConvertOpenAIBatchToCodex_ReportsLine(t *testing.T) {
+	lines := [][]byte{
+		[]byte(`{"custom_id":"req-1","body":{"model":"gpt-5","messages":[{"role":"user","content":"Hi"}]}}`),
+		[]byte(`{"custom_id":"req-2"}`),
+	}
+
+	out, err := ConvertOpenAIBatchToCodex(lines)
+	if err == nil {
+		t.Fatalf("Expected an error, got output %q", out)
+	}
+	if err.Error() != "batch line 1: body must be a JSON object" {
+		t.Errorf("Expected error for line 1, got %v", err)
+	}
+}
+
+// TestConvertOpenAIBatchToCodex_MissingCustomID tests that a line without a custom_id is rejected
+// instead of producing an invalid line
+func TestConvertOpenAIBatchToCodex_MissingCustomID(t *testing.T) {
+	lines := [][]byte{
+		[]byte(`{"method":"POST","url":"/v1/chat/completions","body":{"model":"gpt-5","messages":[{"role":"user","content":"Hi"}]}}`),
+	}
+
+	out, err := ConvertOpenAIBatchToCodex(lines)
+	if err == nil {
+		t.Fatalf("Expected an error, got output %q", out)
+	}
+	if err.Error() != "batch line 0: custom_id must be a string" {
+		t.Errorf("Expected custom_id error for line 0, got %v", err)
+	}
+}
@@ -0,0 +1,50 @@
+package chat_completions
+
+import (
+	"github.com/tidwall/gjson"
+	"github.com/tidwall/sjson"
+)
+
+// ConvertOpenAICompletionRequestToCodex converts a legacy OpenAI Completions request JSON
+// ({"prompt": ...}) into an OpenAI Responses API request JSON. The prompt, either a string or an
+// array of strings, becomes a single user message (one text part per string) and the request is
+// then converted by ConvertOpenAIRequestToCodex.
+//
+// Parameters:
+//   - modelName: The name of the model to use for the request
+//   - rawJSON: The raw JSON request data from the OpenAI Completions API
+//   - stream: A boolean indicating if the request is for a streaming response
+//
+// Returns:
+//   - []byte: The transformed request data in OpenAI Responses API format
+func ConvertOpenAICompletionRequestToCodex(modelName string, inputRawJSON []byte, stream bool) []byte {
+	return ConvertOpenAIRequestToCodex(modelName, completionToChatRequest(inputRawJSON), stream)
+}
+
+// completionToChatRequest rewrites the prompt of a Completions request as a Chat Completions
+// user message. Requests without a prompt are returned unchanged.
+func completionToChatRequest(rawJSON []byte) []byte {
+	prompt := gjson.GetBytes(rawJSON, "prompt")
+	if !prompt.Exists() {
+		return rawJSON
+	}
+
+	content := `[]`
+	if prompt.IsArray() {
+		for _, p := range prompt.Array() {
+			part := `{"type":"text"}`
+			part, _ = sjson.Set(part, "text", p.String())
+			content, _ = sjson.SetRaw(content, "-1", part)
+		}
+	} else {
+		part := `{"type":"text"}`
+		part, _ = sjson.Set(part, "text", prompt.String())
+		content, _ = sjson.SetRaw(content, "-1", part)
+	}
+	msg := `{"role":"user"}`
+	msg, _ = sjson.SetRaw(msg, "content", content)
+
+	out, _ := sjson.DeleteBytes(rawJSON, "prompt")
+	out, _ = sjson.SetRawBytes(out, "messages", []byte(`[`+msg+`]`))
+	return out
+}
@@ -0,0 +1,205 @@
+package chat_completions
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/tidwall/gjson"
+)
+
+// requestFieldTargets maps the top-level Chat Completions fields the translator understands to
+// the Codex path each one is translated into. Any other top-level field is dropped during
+// conversion, and a listed field whose target is missing from the output was dropped as well.
+var requestFieldTargets = map[string]string{
+	"model":            "model",
+	"messages":         "input",
+	"stream":           "stream",
+	"reasoning_effort": "reasoning.effort",
+	"response_format":  "text.format",
+	"text":             "text",
+	"tools":            "tools",
+	"tool_choice":      "tool_choice",
+	"functions":        "tools",
+	"function_call":    "tool_choice",
+	"modalities":       "modalities",
+	"audio":            "audio",
+	"max_tool_calls":   "max_tool_calls",
+	"logprobs":         `include.#(=="message.output_text.logprobs")`,
+	"top_logprobs":     "top_logprobs",
+}
+
+// defaultedFields lists the Codex fields the translator can fill in without a client value.
+var defaultedFields = []string{"include", "instructions", "parallel_tool_calls", "reasoning.effort", "reasoning.summary", "store"}
+
+// ConversionReport describes what ConvertOpenAIRequestToCodex did to a request.
+type ConversionReport struct {
+	// Mapped lists top-level request fields that were translated into the Codex payload.
+	Mapped []string
+	// Dropped lists top-level request fields that did not make it into the Codex payload.
+	Dropped []string
+	// ShortenedToolNames maps original tool names to the shortened names sent upstream.
+	ShortenedToolNames map[string]string
+	// ShortenedCallIDs maps original tool call IDs to the shortened IDs sent upstream.
+	ShortenedCallIDs map[string]string
+	// Defaulted lists Codex fields that were filled with a default value rather than copied.
+	Defaulted []string
+	// Events counts the conversion events (see common.Counters) raised along the way, such as
+	// dropped tools and unsupported content parts.
+	Events map[string]int
+	// Problem is the first problem the strict variants would reject the request for, if any.
+	Problem string
+}
+
+// recordingCounters collects conversion events for ExplainConversion.
+type recordingCounters map[string]int
+
+func (c recordingCounters) Inc(event string) { c[event]++ }
+
+// ExplainConversion runs the Chat Completions to Codex conversion for modelName and reports which
+// fields were mapped, dropped, shortened and defaulted. It is intended for debugging why a request
+// behaves differently when sent through the proxy.
+//
+// Parameters:
+//   - modelName: The name of the model to use for the request
+//   - rawJSON: The raw JSON request data from the OpenAI Chat Completions API
+//
+// Returns:
+//   - ConversionReport: The structured description of the conversion
+//   - error: An error if the request is not valid JSON
+func ExplainConversion(modelName string, rawJSON []byte) (ConversionReport, error) {
+	report := ConversionReport{
+		ShortenedToolNames: map[string]string{},
+		ShortenedCallIDs:   map[string]string{},
+		Events:             map[string]int{},
+	}
+	if !gjson.ValidBytes(rawJSON) {
+		return report, fmt.Errorf("request is not valid JSON")
+	}
+	root := gjson.ParseBytes(rawJSON)
+	if !root.IsObject() {
+		return report, fmt.Errorf("request must be a JSON object")
+	}
+
+	events := recordingCounters{}
+	converted, convErr := convertOpenAIRequestToCodex(modelName, rawJSON, false, Options{Counters: events})
+	if convErr != nil {
+		report.Problem = convErr.Error()
+	}
+	report.Events = events
+	out := gjson.ParseBytes(converted)
+
+	targets := map[string]bool{}
+	root.ForEach(func(key, value gjson.Result) bool {
+		name := key.String()
+		target, ok := requestFieldTargets[name]
+		if ok && value.Type != gjson.Null && out.Get(target).Exists() {
+			report.Mapped = append(report.Mapped, name)
+			targets[target] = true
+		} else {
+			report.Dropped = append(report.Dropped, name)
+		}
+		return true
+	})
+	sort.Strings(report.Mapped)
+	sort.Strings(report.Dropped)
+
+	var names []string
+	for _, t := range root.Get("tools").Array() {
+		if t.Get("type").String() == "function" {
+			if v := t.Get("function.name"); v.Exists() {
+				names = append(names, v.String())
+			}
+		}
+	}
+	for original, short := range buildShortNameMap(names) {
+		if original != short {
+			report.ShortenedToolNames[original] = short
+		}
+	}
+
+	for original, short := range CallIDMap(rawJSON) {
+		report.ShortenedCallIDs[original] = short
+	}
+
+	for _, field := range defaultedFields {
+		if out.Get(field).Exists() && !targets[field] {
+			report.Defaulted = append(report.Defaulted, field)
+		}
+	}
+
+	return report, nil
+}
+
+// DiffConversion runs the Chat Completions to Codex conversion and returns a line-oriented diff of
+// the request before and after it, intended for attaching to bug reports. Both documents are
+// flattened into leaf paths, so the diff lists each removed ("-"), added ("+") and changed ("~")
+// value once, sorted by path.
+//
+// Parameters:
+//   - modelName: The name of the model to use for the request
+//   - rawJSON: The raw JSON request data from the OpenAI Chat Completions API
+//
+// Returns:
+//   - string: The diff, one change per line
+//   - error: An error if the request is not a valid JSON object
+func DiffConversion(modelName string, rawJSON []byte) (string, error) {
+	if !gjson.ValidBytes(rawJSON) || !gjson.ParseBytes(rawJSON).IsObject() {
+		return "", fmt.Errorf("request must be a JSON object")
+	}
+	before := map[string]string{}
+	flattenJSON("", gjson.ParseBytes(rawJSON), before)
+	after := map[string]string{}
+	flattenJSON("", gjson.ParseBytes(ConvertOpenAIRequestToCodex(modelName, rawJSON, false)), after)
+
+	paths := make([]string, 0, len(before)+len(after))
+	for path := range before {
+		paths = append(paths, path)
+	}
+	for path := range after {
+		if _, ok := before[path]; !ok {
+			paths = append(paths, path)
+		}
+	}
+	sort.Strings(paths)
+
+	var b strings.Builder
+	for _, path := range paths {
+		old, inBefore := before[path]
+		updated, inAfter := after[path]
+		switch {
+		case !inAfter:
+			fmt.Fprintf(&b, "- %s: %s\n", path, old)
+		case !inBefore:
+			fmt.Fprintf(&b, "+ %s: %s\n", path, updated)
+		case old != updated:
+			fmt.Fprintf(&b, "~ %s: %s -> %s\n", path, old, updated)
+		}
+	}
+	return b.String(), nil
+}
+
+// flattenJSON records every leaf of value under its dotted path. Empty objects and arrays are
+// recorded as leaves so their presence shows up in the diff.
+func flattenJSON(path string, value gjson.Result, leaves map[string]string) {
+	join := func(key string) string {
+		if path == "" {
+			return key
+		}
+		return path + "." + key
+	}
+	switch {
+	case value.IsObject() && len(value.Map()) > 0:
+		value.ForEach(func(key, v gjson.Result) bool {
+			flattenJSON(join(key.String()), v, leaves)
+			return true
+		})
+	case value.IsArray() && len(value.Array()) > 0:
+		for i, v := range value.Array() {
+			flattenJSON(join(strconv.Itoa(i)), v, leaves)
+		}
+	default:
+		leaves[path] = strings.TrimSpace(value.Raw)
+	}
+}
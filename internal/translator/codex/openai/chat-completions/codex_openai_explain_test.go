@@ -0,0 +1,120 @@
+package chat_completions
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/router-for-me/CLIProxyAPI/v6/internal/translator/codex/common"
+)
+
+// TestExplainConversion_ReportsShortenedAndDropped tests that the report lists a shortened tool
+// name and the stripped temperature field
+func TestExplainConversion_ReportsShortenedAndDropped(t *testing.T) {
+	longName := "mcp__" + strings.Repeat("server_", 10) + "__lookup"
+	inputJSON := []byte(`{
+		"model": "gpt-5.2",
+		"temperature": 0.2,
+		"messages": [{"role": "user", "content": "Hi"}],
+		"tools": [{"type": "function", "function": {"name": "` + longName + `", "parameters": {"type": "object"}}}]
+	}`)
+
+	report, err := ExplainConversion("gpt-5.2", inputJSON)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	if short, ok := report.ShortenedToolNames[longName]; !ok || short != "mcp__lookup" {
+		t.Errorf("Expected %q to be reported as shortened to mcp__lookup, got %v", longName, report.ShortenedToolNames)
+	}
+
+	found := false
+	for _, field := range report.Dropped {
+		if field == "temperature" {
+			found = true
+		}
+	}
+	if !found {
+		t.Errorf("Expected temperature in dropped fields, got %v", report.Dropped)
+	}
+
+	for _, field := range report.Dropped {
+		if field == "messages" || field == "tools" {
+			t.Errorf("Did not expect mapped field %q in dropped fields", field)
+		}
+	}
+
+	if !strings.Contains(strings.Join(report.Defaulted, ","), "reasoning.effort") {
+		t.Errorf("Expected reasoning.effort to be reported as defaulted, got %v", report.Defaulted)
+	}
+}
+
+// TestExplainConversion_InvalidJSON tests that malformed input is reported as an error
+func TestExplainConversion_InvalidJSON(t *testing.T) {
+	if _, err := ExplainConversion("gpt-5.2", []byte(`{"messages":`)); err == nil {
+		t.Error("Expected error for invalid JSON, got nil")
+	}
+}
+
+// TestDiffConversion_MentionsRemovedTemperature tests that the diff lists the stripped temperature
+// field and the added Codex defaults
+func TestDiffConversion_MentionsRemovedTemperature(t *testing.T) {
+	inputJSON := []byte(`{
+		"model": "gpt-5.2",
+		"temperature": 0.2,
+		"messages": [{"role": "user", "content": "Hi"}]
+	}`)
+
+	diff, err := DiffConversion("gpt-5.2", inputJSON)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	for _, line := range []string{"- temperature: 0.2", "+ store: false", "+ input.0.content.0.text: \"Hi\""} {
+		if !strings.Contains(diff, line+"\n") {
+			t.Errorf("Expected diff to contain %q, got:\n%s", line, diff)
+		}
+	}
+	if strings.Contains(diff, "model:") {
+		t.Errorf("Did not expect the unchanged model to be listed, got:\n%s", diff)
+	}
+}
+
+// TestExplainConversion_ReflectsActualConversion tests that fields the model cannot honor are
+// reported as dropped and that dropped tools and images show up as events
+func TestExplainConversion_ReflectsActualConversion(t *testing.T) {
+	inputJSON := []byte(`{
+		"model": "gpt-5.2",
+		"modalities": ["text", "audio"],
+		"audio": {"voice": "alloy", "format": "wav"},
+		"messages": [{"role": "user", "content": [{"type": "text", "text": "Hi"}, {"type": "image_url", "image_url": {"url": "ftp://example.com/cat.png"}}]}],
+		"tools": [
+			{"type": "function", "function": {"name": "lookup", "parameters": {"type": "object"}}},
+			{"type": "function", "function": {"name": "lookup", "parameters": {"type": "object"}}},
+			{"type": "file_search"}
+		]
+	}`)
+
+	report, err := ExplainConversion("gpt-5.2", inputJSON)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if got := strings.Join(report.Dropped, ","); got != "audio,modalities" {
+		t.Errorf("Expected audio and modalities to be dropped for gpt-5.2, got %v", report.Dropped)
+	}
+	if got := report.Events[common.EventToolDropped]; got != 2 {
+		t.Errorf("Expected 2 dropped tools, got %d", got)
+	}
+	if got := report.Events[common.EventUnsupportedContentDropped]; got != 1 {
+		t.Errorf("Expected 1 dropped image, got %d", got)
+	}
+	if report.Problem == "" {
+		t.Error("Expected the first problem to be reported")
+	}
+
+	report, err = ExplainConversion("gpt-audio", inputJSON)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if !strings.Contains(strings.Join(report.Mapped, ","), "audio") {
+		t.Errorf("Expected audio to be mapped for gpt-audio, got %v", report.Mapped)
+	}
+}
@@ -0,0 +1,59 @@
+package chat_completions
+
+import (
+	"fmt"
+
+	"github.com/tidwall/gjson"
+	"github.com/tidwall/sjson"
+)
+
+// maxChoices is the largest n accepted, matching the Chat Completions API limit. Each choice is a
+// full copy of the converted request, so n is bounded before anything is allocated.
+const maxChoices = 128
+
+// ConvertOpenAIRequestToCodexN converts a Chat Completions request asking for n choices into n
+// Codex requests, since Codex produces a single response per request. The proxy can send them
+// concurrently and aggregate the results into one response with n choices. A request without n
+// yields a single payload.
+//
+// Returns:
+//   - [][]byte: The transformed requests, one per requested choice
+//   - error: An error if n is not a positive integer up to 128 or the request is rejected
+func ConvertOpenAIRequestToCodexN(modelName string, rawJSON []byte, stream bool) ([][]byte, error) {
+	return ConvertOpenAIRequestToCodexNWithOptions(modelName, rawJSON, stream, Options{})
+}
+
+// ConvertOpenAIRequestToCodexNWithOptions behaves like ConvertOpenAIRequestToCodexN while honoring
+// opts. With ForwardSeed set, the payloads get consecutive seeds starting at the request's seed
+// (or DefaultSeed) so the choices differ.
+func ConvertOpenAIRequestToCodexNWithOptions(modelName string, rawJSON []byte, stream bool, opts Options) ([][]byte, error) {
+	n := int64(1)
+	if v := gjson.GetBytes(rawJSON, "n"); v.Exists() && v.Type != gjson.Null {
+		if v.Type != gjson.Number || v.Int() < 1 || float64(v.Int()) != v.Float() {
+			return nil, fmt.Errorf("n must be a positive integer")
+		}
+		if v.Int() > maxChoices {
+			return nil, fmt.Errorf("n must be at most %d, got %s", maxChoices, v.Raw)
+		}
+		n = v.Int()
+	}
+
+	out, err := ConvertOpenAIRequestToCodexWithOptions(modelName, rawJSON, stream, opts)
+	if err != nil {
+		return nil, err
+	}
+	payloads := make([][]byte, 0, n)
+	for i := int64(0); i < n; i++ {
+		payload := out
+		if i > 0 {
+			payload = append([]byte(nil), out...)
+		}
+		if opts.ForwardSeed {
+			if payload, err = sjson.SetBytes(payload, "seed", gjson.GetBytes(out, "seed").Int()+i); err != nil {
+				return nil, err
+			}
+		}
+		payloads = append(payloads, payload)
+	}
+	return payloads, nil
+}
@@ -0,0 +1,162 @@
+package chat_completions
+
+import "github.com/router-for-me/CLIProxyAPI/v6/internal/translator/codex/common"
+
+// Options tunes how ConvertOpenAIRequestToCodexWithOptions shapes the Codex request.
+// The zero value reproduces the behavior of ConvertOpenAIRequestToCodex.
+type Options struct {
+	// SplitImagesToSeparateMessages splits a user message carrying several images into
+	// consecutive user messages holding one image each, for Codex versions that only
+	// accept a single image per message.
+	SplitImagesToSeparateMessages bool
+
+	// ParseInlineToolCalls extracts {"tool_call": {...}} JSON blocks embedded in assistant
+	// text and forwards them as function_call items instead of plain text.
+	ParseInlineToolCalls bool
+
+	// GroupFunctionCalls is experimental. It reorders runs of interleaved function_call and
+	// function_call_output items so the calls are grouped ahead of their outputs, for Codex
+	// versions that expect parallel calls to be adjacent.
+	GroupFunctionCalls bool
+
+	// CorrelationID, when set, is stored in metadata.correlation_id of the Codex request so
+	// the call can be traced across the proxy.
+	CorrelationID string
+
+	// TrimTextParts strips a leading UTF-8 byte order mark and surrounding whitespace from
+	// text parts. Parts left empty are dropped.
+	TrimTextParts bool
+
+	// InlineSystemIntoUser folds system/developer messages into the first user message's text
+	// instead of sending separate developer items, for backends without that role.
+	InlineSystemIntoUser bool
+
+	// MaxToolOutputBytes caps the size of tool and function results forwarded to Codex.
+	// Larger outputs are summarized with ToolOutputSummarizer when set, and truncated
+	// otherwise. Zero leaves outputs unchanged.
+	MaxToolOutputBytes int
+
+	// ToolOutputSummarizer replaces a tool output larger than MaxToolOutputBytes with the
+	// returned summary. A summary that is still too large is truncated.
+	ToolOutputSummarizer func(output string) string
+
+	// Truncation sets the Codex truncation strategy ("auto" or "disabled"). Chat Completions
+	// has no equivalent field, so clients opt in through this option. Empty leaves it unset.
+	Truncation string
+
+	// MetadataReasoningEffort reads metadata.reasoning_effort when the top-level
+	// reasoning_effort field is absent, for gateways that move it there.
+	MetadataReasoningEffort bool
+
+	// ModelName rewrites the model name (provider prefixes, aliases) before it is set on
+	// the Codex request and used for capability lookups.
+	ModelName common.ModelNameNormalization
+
+	// DefaultInstructions, when set, is injected as a leading developer message for
+	// requests that carry no system or developer message.
+	DefaultInstructions string
+
+	// CodexCompatFields fills in the fields the Codex CLI always sends, for backends that
+	// reject requests lacking them. See codexCompatFields for the set; fields the client
+	// already provided are left untouched.
+	CodexCompatFields bool
+
+	// PreserveCacheControl forwards prompt caching hints (cache_control) found on messages
+	// and content parts instead of dropping them.
+	PreserveCacheControl bool
+
+	// ForwardMaxOutputTokens maps max_completion_tokens (or max_tokens) to max_output_tokens
+	// for backends that accept it. A zero limit is omitted.
+	ForwardMaxOutputTokens bool
+
+	// ForwardImageMimeType copies image_url.mime_type onto the input_image part for backends
+	// that accept it. The detail field is always carried; other image_url extras are dropped.
+	ForwardImageMimeType bool
+
+	// PreserveMessageMetadata copies a message's metadata object onto the emitted message item,
+	// which helps when debugging replayed conversations.
+	PreserveMessageMetadata bool
+
+	// HoistSystemToInstructions moves the text of a leading system or developer message into the
+	// top-level instructions field and leaves that message out of the input. Later system and
+	// developer messages stay in the input as developer messages. DefaultInstructions is not
+	// injected when a message was hoisted.
+	HoistSystemToInstructions bool
+
+	// Counters, when set, is notified of conversion events such as shortened tool names and
+	// stripped fields. See the Event constants in the common package.
+	Counters common.Counters
+
+	// InstructionsPrefix is prepended to the instructions, for example to replicate the Codex
+	// CLI preamble. It is not added again when the instructions or a developer message already
+	// start with it.
+	InstructionsPrefix string
+
+	// DefaultReasoningEfforts maps model name prefixes to the reasoning effort used when the
+	// request sets none. The longest matching prefix wins; unlisted models default to medium.
+	DefaultReasoningEfforts map[string]string
+
+	// RejectFormatToolChoiceConflict reports requests that combine a json_schema response_format
+	// with a forced tool_choice ("required" or a specific tool), whose behavior on Codex is
+	// undefined. The lenient conversion still forwards them unchanged.
+	RejectFormatToolChoiceConflict bool
+
+	// ReasoningEffort, when set, replaces the reasoning effort of every request.
+	ReasoningEffort string
+
+	// DisableReasoningSummary omits the reasoning summary request, so responses carry no
+	// summary text.
+	DisableReasoningSummary bool
+
+	// ForwardSeed forwards the request's seed, or DefaultSeed when it has none, for backends
+	// that accept one.
+	ForwardSeed bool
+
+	// DefaultSeed is the seed sent by ForwardSeed for requests without a seed.
+	DefaultSeed int64
+
+	// MaxTools limits how many tools a request may declare; zero means no limit. Requests over
+	// the limit are reported as errors unless TruncateTools is set.
+	MaxTools int
+
+	// TruncateTools keeps only the first MaxTools tools, with a warning, instead of reporting
+	// requests that declare more.
+	TruncateTools bool
+
+	// PreserveUnknownFields copies top-level fields that are not part of the Chat Completions
+	// API, such as vendor extensions, into the Codex request unchanged. Known fields the
+	// translator drops stay dropped.
+	PreserveUnknownFields bool
+
+	// InlineSchemaRefs replaces $ref pointers into $defs within function parameters with the
+	// referenced schema, for strict modes that reject references. Schemas that cannot be
+	// flattened, such as recursive ones, are forwarded unchanged.
+	InlineSchemaRefs bool
+
+	// MaxImageBytes limits the decoded size of inline (data URL) images; zero means no limit.
+	// Larger images are reported as errors unless DropOversizedImages is set.
+	MaxImageBytes int
+
+	// DropOversizedImages removes images over MaxImageBytes, with a warning, instead of
+	// reporting them.
+	DropOversizedImages bool
+
+	// ForceStrictTools enables strict schema adherence on every function tool that does not
+	// set strict itself. A tool declaring strict:false keeps it.
+	ForceStrictTools bool
+}
+
+// deterministicSeed is the seed DeterministicMode uses for requests without one.
+const deterministicSeed = 1234
+
+// DeterministicMode returns the preset intended for integration tests that replay requests
+// against Codex: a seed is always sent (the request's own or a fixed one), reasoning
+// summaries are disabled and the reasoning effort is pinned to low.
+func DeterministicMode() Options {
+	return Options{
+		ForwardSeed:             true,
+		DefaultSeed:             deterministicSeed,
+		DisableReasoningSummary: true,
+		ReasoningEffort:         "low",
+	}
+}
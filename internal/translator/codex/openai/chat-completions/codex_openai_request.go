@@ -7,11 +7,22 @@
 package chat_completions
 
 import (
+	"bytes"
+	"context"
 	"crypto/sha256"
 	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/url"
+	"regexp"
+	"sort"
 	"strconv"
 	"strings"
+	"unicode/utf8"
 
+	"github.com/router-for-me/CLIProxyAPI/v6/internal/translator/codex/common"
+	log "github.com/sirupsen/logrus"
 	"github.com/tidwall/gjson"
 	"github.com/tidwall/sjson"
 )
@@ -29,44 +40,267 @@ import (
 // Returns:
 //   - []byte: The transformed request data in OpenAI Responses API format
 func ConvertOpenAIRequestToCodex(modelName string, inputRawJSON []byte, stream bool) []byte {
+	out, _ := convertOpenAIRequestToCodex(modelName, inputRawJSON, stream, Options{})
+	return out
+}
+
+// ConvertOpenAIRequestToCodexE performs the same conversion as ConvertOpenAIRequestToCodex but
+// reports requests the Codex backend would reject instead of silently repairing them.
+//
+// Returns:
+//   - []byte: The transformed request data, or nil when the request is rejected
+//   - error: A descriptive error for the first problem found
+func ConvertOpenAIRequestToCodexE(modelName string, inputRawJSON []byte, stream bool) ([]byte, error) {
+	return ConvertOpenAIRequestToCodexWithOptions(modelName, inputRawJSON, stream, Options{})
+}
+
+// ConvertOpenAIRequestToCodexWithOptions behaves like ConvertOpenAIRequestToCodexE while
+// honoring the behavior switches in opts.
+func ConvertOpenAIRequestToCodexWithOptions(modelName string, inputRawJSON []byte, stream bool, opts Options) ([]byte, error) {
+	out, err := convertOpenAIRequestToCodex(modelName, inputRawJSON, stream, opts)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// ConvertOpenAIRequestToCodexCtx behaves like ConvertOpenAIRequestToCodexE but stops early when
+// ctx is cancelled, which matters for very long conversations.
+//
+// Returns:
+//   - []byte: The transformed request data, or nil when the request is rejected or cancelled
+//   - error: The context error when cancelled, otherwise the first conversion problem
+func ConvertOpenAIRequestToCodexCtx(ctx context.Context, modelName string, inputRawJSON []byte, stream bool) ([]byte, error) {
+	out, err := convertOpenAIRequestToCodexCtx(ctx, modelName, inputRawJSON, stream, Options{})
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// WriteOpenAIRequestToCodex performs the same conversion as ConvertOpenAIRequestToCodexE but
+// writes the resulting JSON to w. The input items are still converted in full before anything is
+// written; they are then written one by one instead of being copied into one intermediate
+// payload first. Nothing is written when the request is rejected.
+//
+// Returns:
+//   - error: The first conversion problem, or the error returned by w
+func WriteOpenAIRequestToCodex(w io.Writer, modelName string, rawJSON []byte, stream bool) error {
+	if common.IsCodexRequest(rawJSON) {
+		out, err := retargetCodexRequest(modelName, rawJSON, stream, Options{})
+		if err != nil {
+			return err
+		}
+		_, err = w.Write(out)
+		return err
+	}
+	req, err := buildCodexRequest(context.Background(), modelName, rawJSON, stream, Options{})
+	if err != nil {
+		return err
+	}
+	return req.writeTo(w)
+}
+
+// convertOpenAIRequestToCodex builds the Codex request. Problems the backend would reject are
+// repaired or dropped in the returned payload, and the first of them is reported as an error so
+// the strict variants can surface it.
+func convertOpenAIRequestToCodex(modelName string, inputRawJSON []byte, stream bool, opts Options) ([]byte, error) {
+	return convertOpenAIRequestToCodexCtx(context.Background(), modelName, inputRawJSON, stream, opts)
+}
+
+// codexCompatFields lists the fields, with their defaults, that the Codex CLI includes on every
+// request and that some ChatGPT-backed Codex deployments require:
+//   - tools: the tool list, empty when the client declared none
+//   - tool_choice: "auto" unless the client chose otherwise
+var codexCompatFields = []struct {
+	path string
+	raw  string
+}{
+	{path: "tools", raw: `[]`},
+	{path: "tool_choice", raw: `"auto"`},
+}
+
+// ctxCheckInterval is how many messages are converted between cancellation checks.
+const ctxCheckInterval = 64
+
+func convertOpenAIRequestToCodexCtx(ctx context.Context, modelName string, inputRawJSON []byte, stream bool, opts Options) ([]byte, error) {
+	// Converting an already converted request would find no messages and drop the conversation,
+	// so Codex payloads are only re-targeted.
+	if common.IsCodexRequest(inputRawJSON) {
+		return retargetCodexRequest(modelName, inputRawJSON, stream, opts)
+	}
+	req, err := buildCodexRequest(ctx, modelName, inputRawJSON, stream, opts)
+	if req.doc == "" {
+		return nil, err
+	}
+	return req.bytes(), err
+}
+
+// retargetCodexRequest handles a request that is already in Codex shape. Its input is kept as is,
+// but the model and stream flag of this call are applied and the fields no Codex backend accepts
+// are stripped, since a client can send a Responses-shaped body that merely looks converted.
+func retargetCodexRequest(modelName string, rawJSON []byte, stream bool, opts Options) ([]byte, error) {
+	var ed common.JSONEditor
+	out := bytes.Clone(rawJSON)
+	out = ed.SetBytes(out, "model", common.NormalizeModelName(modelName, opts.ModelName))
+	out = ed.SetBytes(out, "stream", stream)
+	for _, field := range common.RejectedFields() {
+		out = ed.DeleteBytes(out, field)
+	}
+	if err := ed.Finish(out); err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// codexRequest is a converted request whose input items are held apart from the rest of the
+// document until it is serialized, so large conversations are never rebuilt item by item.
+type codexRequest struct {
+	// doc is the request with an empty input array.
+	doc string
+	// input holds the raw JSON of each input item in order.
+	input []string
+}
+
+// writeTo writes the request JSON to w with the input items spliced into doc.
+func (r codexRequest) writeTo(w io.Writer) error {
+	idx := gjson.Get(r.doc, "input").Index
+	if _, err := io.WriteString(w, r.doc[:idx+1]); err != nil {
+		return err
+	}
+	for i, item := range r.input {
+		if i > 0 {
+			if _, err := io.WriteString(w, ","); err != nil {
+				return err
+			}
+		}
+		if _, err := io.WriteString(w, item); err != nil {
+			return err
+		}
+	}
+	_, err := io.WriteString(w, r.doc[idx+1:])
+	return err
+}
+
+// bytes serializes the request into a single buffer.
+func (r codexRequest) bytes() []byte {
+	size := len(r.doc) + len(r.input)
+	for _, item := range r.input {
+		size += len(item)
+	}
+	var buf bytes.Buffer
+	buf.Grow(size)
+	_ = r.writeTo(&buf)
+	return buf.Bytes()
+}
+
+// buildCodexRequest performs the conversion. A zero codexRequest is returned only when ctx is
+// canceled; otherwise the repaired request comes back together with the first problem found.
+func buildCodexRequest(ctx context.Context, modelName string, inputRawJSON []byte, stream bool, opts Options) (codexRequest, error) {
 	rawJSON := inputRawJSON
+	modelName = common.NormalizeModelName(modelName, opts.ModelName)
+	var ed common.JSONEditor
+	var convErr error
+	count := func(event string) {
+		if opts.Counters != nil {
+			opts.Counters.Inc(event)
+		}
+	}
+	fail := func(err error) {
+		if convErr == nil {
+			convErr = err
+		}
+	}
+	if !gjson.ValidBytes(rawJSON) || !gjson.ParseBytes(rawJSON).IsObject() {
+		fail(fmt.Errorf("request must be a JSON object"))
+	} else {
+		// Explicit nulls ("tool_choice": null, ...) mean the field is not set.
+		rawJSON = common.DropNullFields(rawJSON)
+	}
+	isObject := convErr == nil
+	// consumed records top-level fields an option read into a differently named Codex field, so
+	// they are not counted as stripped.
+	consumed := map[string]bool{}
 	// Start with empty JSON object
 	out := `{"instructions":""}`
 
 	// Stream must be set to true
-	out, _ = sjson.Set(out, "stream", stream)
+	out = ed.Set(out, "stream", stream)
 
 	// Codex not support temperature, top_p, top_k, max_output_tokens, so comment them
 	// if v := gjson.GetBytes(rawJSON, "temperature"); v.Exists() {
-	// 	out, _ = sjson.Set(out, "temperature", v.Value())
+	// 	out = ed.Set(out, "temperature", v.Value())
 	// }
 	// if v := gjson.GetBytes(rawJSON, "top_p"); v.Exists() {
-	// 	out, _ = sjson.Set(out, "top_p", v.Value())
+	// 	out = ed.Set(out, "top_p", v.Value())
 	// }
 	// if v := gjson.GetBytes(rawJSON, "top_k"); v.Exists() {
-	// 	out, _ = sjson.Set(out, "top_k", v.Value())
+	// 	out = ed.Set(out, "top_k", v.Value())
 	// }
 
-	// Map token limits
-	// if v := gjson.GetBytes(rawJSON, "max_tokens"); v.Exists() {
-	// 	out, _ = sjson.Set(out, "max_output_tokens", v.Value())
-	// }
-	// if v := gjson.GetBytes(rawJSON, "max_completion_tokens"); v.Exists() {
-	// 	out, _ = sjson.Set(out, "max_output_tokens", v.Value())
-	// }
+	// Map token limits only for backends that accept them; the Codex backend rejects
+	// max_output_tokens, so they are dropped by default.
+	if opts.ForwardMaxOutputTokens {
+		if limit, ok := outputTokenLimit(rawJSON); ok {
+			out = ed.Set(out, "max_output_tokens", limit)
+			consumed["max_completion_tokens"] = true
+			consumed["max_tokens"] = true
+		}
+	}
+
+	// Legacy function calling (functions/function_call) is rewritten into the tools shape so the
+	// rest of the conversion handles both. It only ever produces a single call per turn.
+	legacyFunctions := isLegacyFunctionsRequest(rawJSON)
+	if legacyFunctions {
+		rawJSON = legacyFunctionsToTools(rawJSON)
+	}
 
 	// Map reasoning effort
-	if v := gjson.GetBytes(rawJSON, "reasoning_effort"); v.Exists() {
-		out, _ = sjson.Set(out, "reasoning.effort", v.Value())
-	} else {
-		out, _ = sjson.Set(out, "reasoning.effort", "medium")
+	v := gjson.GetBytes(rawJSON, "reasoning_effort")
+	if !v.Exists() && opts.MetadataReasoningEffort {
+		// Some gateways stash the effort in metadata instead of the top-level field.
+		v = gjson.GetBytes(rawJSON, "metadata.reasoning_effort")
+		consumed["metadata"] = v.Exists()
+	}
+	switch {
+	case opts.ReasoningEffort != "":
+		out = ed.Set(out, "reasoning.effort", opts.ReasoningEffort)
+	case v.Type == gjson.Number:
+		// Some clients send the effort as a level from 0 (minimal) to 3 (high).
+		if effort, ok := common.ReasoningEffortFromLevel(v.Float()); ok {
+			out = ed.Set(out, "reasoning.effort", effort)
+		} else {
+			fail(fmt.Errorf("reasoning_effort level %s is out of range", v.Raw))
+			out = ed.Set(out, "reasoning.effort", common.DefaultReasoningEffort(modelName, opts.DefaultReasoningEfforts))
+		}
+	case v.Exists() && v.Type != gjson.Null:
+		out = ed.Set(out, "reasoning.effort", v.Value())
+	default:
+		out = ed.Set(out, "reasoning.effort", common.DefaultReasoningEffort(modelName, opts.DefaultReasoningEfforts))
 	}
-	out, _ = sjson.Set(out, "parallel_tool_calls", true)
-	out, _ = sjson.Set(out, "reasoning.summary", "auto")
-	out, _ = sjson.Set(out, "include", []string{"reasoning.encrypted_content"})
+	out = ed.Set(out, "parallel_tool_calls", !legacyFunctions)
+	if !opts.DisableReasoningSummary {
+		out = ed.Set(out, "reasoning.summary", "auto")
+	}
+	if opts.ForwardSeed {
+		if seed := gjson.GetBytes(rawJSON, "seed"); seed.Type == gjson.Number {
+			out = ed.Set(out, "seed", seed.Int())
+		} else {
+			out = ed.Set(out, "seed", opts.DefaultSeed)
+		}
+	}
+	include := []string{"reasoning.encrypted_content"}
+	if gjson.GetBytes(rawJSON, "logprobs").Bool() {
+		// Responses returns token log probabilities only when asked for via include.
+		include = append(include, "message.output_text.logprobs")
+		if v := gjson.GetBytes(rawJSON, "top_logprobs"); v.Type == gjson.Number {
+			out = ed.Set(out, "top_logprobs", v.Int())
+		}
+	}
+	out = ed.Set(out, "include", include)
 
 	// Model
-	out, _ = sjson.Set(out, "model", modelName)
+	out = ed.Set(out, "model", modelName)
 
 	// Build tool name shortening map from original tools (if any)
 	originalToolNameMap := map[string]string{}
@@ -102,135 +336,367 @@ func ConvertOpenAIRequestToCodex(modelName string, inputRawJSON []byte, stream b
 		}
 		short := shortenCallID(id)
 		callIDMap[id] = short
+		count(common.EventCallIDShortened)
 		return short
 	}
 
-	// Extract system instructions from first system message (string or text object)
+	// legacyCallIDs queues call IDs issued for legacy function_call messages, keyed by function
+	// name, so the following function-role results can reuse them.
+	legacyCallIDs := map[string][]string{}
+
+	// Tool calls sent without an id get a deterministic synthetic one; tool results without a
+	// tool_call_id consume those ids in order so the pair still matches.
+	functionCallCount := 0
+	var pendingSynthesizedCallIDs []string
+
+	// input collects the converted input items. They are spliced into the request in one pass
+	// at the end instead of being appended to the growing document one at a time.
+	var input []string
+
+	// appendFunctionCall emits an assistant tool call as a top-level function_call item.
+	appendFunctionCall := func(callID, name, arguments string) {
+		if callID == "" {
+			callID = synthesizeCallID(functionCallCount, name, arguments)
+			pendingSynthesizedCallIDs = append(pendingSynthesizedCallIDs, callID)
+		}
+		functionCallCount++
+		funcCall := `{}`
+		funcCall = ed.Set(funcCall, "type", "function_call")
+		funcCall = ed.Set(funcCall, "call_id", normalizeCallID(callID))
+		if short, ok := originalToolNameMap[name]; ok {
+			name = short
+		} else {
+			name = shortenNameIfNeeded(name)
+		}
+		funcCall = ed.Set(funcCall, "name", name)
+		funcCall = ed.Set(funcCall, "arguments", arguments)
+		input = append(input, funcCall)
+	}
+
+	// Extract system instructions from a leading system/developer message (string or text parts)
+	// when hoisting is enabled; that message is then left out of the input. Later system and
+	// developer messages keep their place in the conversation.
 	messages := gjson.GetBytes(rawJSON, "messages")
-	// if messages.IsArray() {
-	// 	arr := messages.Array()
-	// 	for i := 0; i < len(arr); i++ {
-	// 		m := arr[i]
-	// 		if m.Get("role").String() == "system" {
-	// 			c := m.Get("content")
-	// 			if c.Type == gjson.String {
-	// 				out, _ = sjson.Set(out, "instructions", c.String())
-	// 			} else if c.IsObject() && c.Get("type").String() == "text" {
-	// 				out, _ = sjson.Set(out, "instructions", c.Get("text").String())
-	// 			}
-	// 			break
-	// 		}
-	// 	}
-	// }
+	if messages.Exists() && !messages.IsArray() {
+		// A malformed messages field would otherwise silently produce an empty conversation.
+		fail(fmt.Errorf("messages must be an array, got %s", messages.Type))
+	}
+	hoistedIndex := -1
+	if first := messages.Get("0"); opts.HoistSystemToInstructions && messages.IsArray() && first.Exists() {
+		switch strings.ToLower(strings.TrimSpace(first.Get("role").String())) {
+		case "system", "developer":
+			out = ed.Set(out, "instructions", systemText(first.Get("content")))
+			hoistedIndex = 0
+		}
+	}
 
 	// Build input from messages, handling all message types including tool calls
-	out, _ = sjson.SetRaw(out, "input", `[]`)
+	out = ed.SetRaw(out, "input", `[]`)
 	if messages.IsArray() {
 		arr := messages.Array()
 		for i := 0; i < len(arr); i++ {
+			if i%ctxCheckInterval == 0 {
+				if err := ctx.Err(); err != nil {
+					return codexRequest{}, err
+				}
+			}
+			if i == hoistedIndex {
+				continue
+			}
 			m := arr[i]
-			role := m.Get("role").String()
+			role := strings.ToLower(strings.TrimSpace(m.Get("role").String()))
 
 			switch role {
 			case "tool":
 				// Handle tool response messages as top-level function_call_output objects
 				toolCallID := normalizeCallID(m.Get("tool_call_id").String())
-				content := m.Get("content").String()
-
+				if toolCallID == "" && len(pendingSynthesizedCallIDs) > 0 {
+					toolCallID = pendingSynthesizedCallIDs[0]
+					pendingSynthesizedCallIDs = pendingSynthesizedCallIDs[1:]
+				}
 				// Create function_call_output object
 				funcOutput := `{}`
-				funcOutput, _ = sjson.Set(funcOutput, "type", "function_call_output")
-				funcOutput, _ = sjson.Set(funcOutput, "call_id", toolCallID)
-				funcOutput, _ = sjson.Set(funcOutput, "output", content)
-				out, _ = sjson.SetRaw(out, "input.-1", funcOutput)
+				funcOutput = ed.Set(funcOutput, "type", "function_call_output")
+				funcOutput = ed.Set(funcOutput, "call_id", toolCallID)
+				structured, ok, err := toolOutputWithImages(m.Get("content"), i, opts)
+				fail(err)
+				if ok {
+					// Image-bearing results (e.g. screenshots) are forwarded as an array of
+					// input_text/input_image items instead of being stringified.
+					funcOutput = ed.SetRaw(funcOutput, "output", structured)
+				} else {
+					funcOutput = ed.Set(funcOutput, "output", limitToolOutput(m.Get("content").String(), opts))
+				}
+				input = append(input, funcOutput)
+
+			case "function":
+				// Legacy function results (pre-tools API) identify the call only by function
+				// name. Pair them with the oldest pending legacy call of that name, or derive
+				// a stable call_id when none is pending.
+				name := m.Get("name").String()
+				callID := ""
+				if pending := legacyCallIDs[name]; len(pending) > 0 {
+					callID = pending[0]
+					legacyCallIDs[name] = pending[1:]
+				} else {
+					callID = synthesizeCallID(i, name, "")
+				}
+				funcOutput := `{}`
+				funcOutput = ed.Set(funcOutput, "type", "function_call_output")
+				funcOutput = ed.Set(funcOutput, "call_id", callID)
+				funcOutput = ed.Set(funcOutput, "output", limitToolOutput(m.Get("content").String(), opts))
+				input = append(input, funcOutput)
 
 			default:
 				// Handle regular messages
+				if name := m.Get("name"); name.Exists() {
+					// Responses message items have no participant name field.
+					log.Debugf("codex translator: dropping name %q from %s message", name.String(), role)
+				}
 				msg := `{}`
-				msg, _ = sjson.Set(msg, "type", "message")
+				msg = ed.Set(msg, "type", "message")
 				if role == "system" {
-					msg, _ = sjson.Set(msg, "role", "developer")
+					msg = ed.Set(msg, "role", "developer")
 				} else {
-					msg, _ = sjson.Set(msg, "role", role)
+					msg = ed.Set(msg, "role", role)
 				}
 
-				msg, _ = sjson.SetRaw(msg, "content", `[]`)
+				msg = ed.SetRaw(msg, "content", `[]`)
 
 				// Handle regular content
 				c := m.Get("content")
-				if c.Exists() && c.Type == gjson.String && c.String() != "" {
-					// Single string content
+				var contentToolCalls []gjson.Result
+				var generatedImages []string
+				appendTextPart := func(value gjson.Result) {
+					if value.String() == "" {
+						// Empty text carries nothing; emitting it would leave a stray part next
+						// to images, matching how empty string content is already skipped.
+						return
+					}
 					partType := "input_text"
 					if role == "assistant" {
 						partType = "output_text"
 					}
+					// Text forwarded unchanged reuses the client's already escaped JSON string, so
+					// very long texts are not escaped a second time.
+					rewrite := opts.TrimTextParts || (opts.ParseInlineToolCalls && role == "assistant")
+					if value.Type == gjson.String && !rewrite {
+						msg = ed.SetRaw(msg, "content.-1", `{"type":"`+partType+`","text":`+value.Raw+`}`)
+						return
+					}
+					text := value.String()
+					if opts.TrimTextParts {
+						text = strings.TrimSpace(strings.TrimPrefix(text, "\uFEFF"))
+						if text == "" {
+							return
+						}
+					}
+					if opts.ParseInlineToolCalls && role == "assistant" {
+						var inline []gjson.Result
+						text, inline = extractInlineToolCalls(text)
+						contentToolCalls = append(contentToolCalls, inline...)
+						if text == "" && len(inline) > 0 {
+							return
+						}
+					}
 					part := `{}`
-					part, _ = sjson.Set(part, "type", partType)
-					part, _ = sjson.Set(part, "text", c.String())
-					msg, _ = sjson.SetRaw(msg, "content.-1", part)
+					part = ed.Set(part, "type", partType)
+					part = ed.Set(part, "text", text)
+					msg = ed.SetRaw(msg, "content.-1", part)
+				}
+				if c.Exists() && c.Type == gjson.String && c.String() != "" {
+					// Single string content
+					appendTextPart(c)
 				} else if c.Exists() && c.IsArray() {
+					// Parts are appended in source order so interleaved text and images keep
+					// their original sequence.
 					items := c.Array()
 					for j := 0; j < len(items); j++ {
 						it := items[j]
-						t := it.Get("type").String()
+						partsBefore := gjson.Get(msg, "content.#").Int()
+						// Part types are matched case-insensitively; some clients send "Text" or "IMAGE_URL".
+						t := strings.ToLower(strings.TrimSpace(it.Get("type").String()))
 						switch t {
-						case "text":
-							partType := "input_text"
-							if role == "assistant" {
-								partType = "output_text"
+						case "text", "input_text", "output_text":
+							// Responses-shaped text parts from pre-converted inputs are accepted too
+							// and retyped for the message role like plain text parts.
+							text := it.Get("text")
+							if text.IsObject() {
+								// Assistants API messages nest the text as {"value": ..., "annotations": [...]}.
+								text = text.Get("value")
 							}
-							part := `{}`
-							part, _ = sjson.Set(part, "type", partType)
-							part, _ = sjson.Set(part, "text", it.Get("text").String())
-							msg, _ = sjson.SetRaw(msg, "content.-1", part)
-						case "image_url":
-							// Map image inputs to input_image for Responses API
+							appendTextPart(text)
+						case "image_url", "input_image":
+							// Map image inputs to input_image for Responses API. Parts already in
+							// Responses form (e.g. produced by a shim) are accepted as well.
 							if role == "user" {
+								imageURL := it.Get("image_url.url")
+								if !imageURL.Exists() && it.Get("image_url").Type == gjson.String {
+									// Some client libraries send the URL directly as a string.
+									imageURL = it.Get("image_url")
+								}
+								if imageURL.Exists() && !isForwardableImageURL(imageURL.String()) {
+									log.Warnf("codex translator: dropping image with unsupported URL scheme in message %d", i)
+									fail(fmt.Errorf("messages[%d].content[%d]: image URL must use http, https or data scheme", i, j))
+									count(common.EventUnsupportedContentDropped)
+									continue
+								}
+								if size, ok := common.DataURLSize(imageURL.String()); ok && opts.MaxImageBytes > 0 && size > opts.MaxImageBytes {
+									if opts.DropOversizedImages {
+										log.Warnf("codex translator: dropping %d byte image in message %d", size, i)
+										continue
+									}
+									fail(fmt.Errorf("messages[%d].content[%d]: image is %d bytes, more than the limit of %d", i, j, size, opts.MaxImageBytes))
+								}
 								part := `{}`
-								part, _ = sjson.Set(part, "type", "input_image")
-								if u := it.Get("image_url.url"); u.Exists() {
-									part, _ = sjson.Set(part, "image_url", u.String())
+								part = ed.Set(part, "type", "input_image")
+								if imageURL.Exists() {
+									part = ed.Set(part, "image_url", imageURL.String())
+								}
+								if t == "input_image" {
+									if v := it.Get("file_id"); v.Exists() {
+										part = ed.Set(part, "file_id", v.String())
+									}
+									if v := it.Get("detail"); v.Exists() {
+										part = ed.Set(part, "detail", v.String())
+									}
+								} else if v := it.Get("image_url.detail"); v.Exists() {
+									part = ed.Set(part, "detail", v.String())
+								}
+								// Other image_url extras (size, ...) have no Responses equivalent and are dropped.
+								if v := it.Get("image_url.mime_type"); opts.ForwardImageMimeType && v.Exists() {
+									part = ed.Set(part, "mime_type", v.String())
+								}
+								msg = ed.SetRaw(msg, "content.-1", part)
+							} else if role == "assistant" {
+								// Images in assistant turns were generated by the model; replay them
+								// as image_generation_call items, which carry the image inline.
+								imageURL := it.Get("image_url.url")
+								if !imageURL.Exists() {
+									imageURL = it.Get("image_url")
 								}
-								msg, _ = sjson.SetRaw(msg, "content.-1", part)
+								if result, ok := generatedImageResult(imageURL.String()); ok {
+									generatedImages = append(generatedImages, result)
+								} else {
+									log.Warnf("codex translator: dropping assistant image without inline data in message %d", i)
+									count(common.EventUnsupportedContentDropped)
+								}
+							} else {
+								count(common.EventUnsupportedContentDropped)
 							}
 						case "file":
 							// Files are not specified in examples; skip for now
+							count(common.EventUnsupportedContentDropped)
+						case "tool_call", "function_call":
+							// Some clients embed assistant tool calls in the content array; collect
+							// them so they are emitted as function_call items after the message.
+							if role == "assistant" {
+								contentToolCalls = append(contentToolCalls, it)
+							} else {
+								count(common.EventUnsupportedContentDropped)
+							}
+						default:
+							count(common.EventUnsupportedContentDropped)
+						}
+						// Carry a prompt caching hint over to the part this item produced.
+						if hint := it.Get("cache_control"); opts.PreserveCacheControl && hint.Exists() {
+							if n := gjson.Get(msg, "content.#").Int(); n > partsBefore {
+								msg = ed.SetRaw(msg, fmt.Sprintf("content.%d.cache_control", n-1), hint.Raw)
+							}
 						}
 					}
 				}
+				if hint := m.Get("cache_control"); opts.PreserveCacheControl && hint.Exists() {
+					msg = ed.SetRaw(msg, "cache_control", hint.Raw)
+				}
+				if meta := m.Get("metadata"); opts.PreserveMessageMetadata && meta.IsObject() {
+					msg = ed.SetRaw(msg, "metadata", meta.Raw)
+				}
+
+				// Assistant refusals carry no regular content; replay them as refusal parts
+				// instead of forwarding an empty message.
+				if role == "assistant" {
+					if refusal := m.Get("refusal"); refusal.Type == gjson.String && refusal.String() != "" {
+						part := `{"type":"refusal"}`
+						part = ed.Set(part, "refusal", refusal.String())
+						msg = ed.SetRaw(msg, "content.-1", part)
+					}
+				}
+
+				if opts.SplitImagesToSeparateMessages && role == "user" {
+					for _, split := range splitImageParts(msg, &ed) {
+						input = append(input, split)
+					}
+				} else {
+					input = append(input, msg)
+				}
 
-				out, _ = sjson.SetRaw(out, "input.-1", msg)
+				for _, result := range generatedImages {
+					item := `{"type":"image_generation_call","status":"completed"}`
+					item = ed.Set(item, "id", generatedImageID(result))
+					item = ed.Set(item, "result", result)
+					input = append(input, item)
+				}
 
 				// Handle tool calls for assistant messages as separate top-level objects
 				if role == "assistant" {
 					toolCalls := m.Get("tool_calls")
 					if toolCalls.Exists() && toolCalls.IsArray() {
-						toolCallsArr := toolCalls.Array()
+						toolCallsArr := sortToolCallsByIndex(toolCalls.Array())
 						for j := 0; j < len(toolCallsArr); j++ {
 							tc := toolCallsArr[j]
 							if tc.Get("type").String() == "function" {
-								// Create function_call as top-level object
-								funcCall := `{}`
-								funcCall, _ = sjson.Set(funcCall, "type", "function_call")
-								funcCall, _ = sjson.Set(funcCall, "call_id", normalizeCallID(tc.Get("id").String()))
-								{
-									name := tc.Get("function.name").String()
-									if short, ok := originalToolNameMap[name]; ok {
-										name = short
-									} else {
-										name = shortenNameIfNeeded(name)
-									}
-									funcCall, _ = sjson.Set(funcCall, "name", name)
-								}
-								funcCall, _ = sjson.Set(funcCall, "arguments", tc.Get("function.arguments").String())
-								out, _ = sjson.SetRaw(out, "input.-1", funcCall)
+								appendFunctionCall(tc.Get("id").String(), tc.Get("function.name").String(), argumentsString(tc.Get("function.arguments")))
+							} else if !tc.Get("type").Exists() && tc.Get("name").Exists() && tc.Get("arguments").Exists() {
+								// Some clients drop the function wrapper and put name/arguments on the entry itself.
+								appendFunctionCall(tc.Get("id").String(), tc.Get("name").String(), argumentsString(tc.Get("arguments")))
 							}
 						}
 					}
+
+					// Legacy assistant messages carry a single function_call instead of
+					// tool_calls. It has no id, so synthesize one and queue it for the
+					// function-role result that follows.
+					if fc := m.Get("function_call"); fc.IsObject() {
+						name := fc.Get("name").String()
+						args := argumentsString(fc.Get("arguments"))
+						callID := fc.Get("id").String()
+						if callID == "" {
+							callID = synthesizeCallID(i, name, args)
+						}
+						legacyCallIDs[name] = append(legacyCallIDs[name], normalizeCallID(callID))
+						appendFunctionCall(callID, name, args)
+					}
+
+					// Content-embedded tool calls carry the same data either under "function"
+					// (Chat Completions shape) or flattened (Responses shape).
+					for _, part := range contentToolCalls {
+						callID := part.Get("id").String()
+						if callID == "" {
+							callID = part.Get("call_id").String()
+						}
+						fn := part
+						if part.Get("function").IsObject() {
+							fn = part.Get("function")
+						}
+						appendFunctionCall(callID, fn.Get("name").String(), argumentsString(fn.Get("arguments")))
+					}
 				}
 			}
 		}
 	}
+	if opts.GroupFunctionCalls {
+		input = groupFunctionCallItems(input)
+	}
+	if opts.DefaultInstructions != "" && hoistedIndex < 0 {
+		input = injectDefaultInstructions(input, opts.DefaultInstructions, &ed)
+	}
+	if opts.InlineSystemIntoUser {
+		input = inlineSystemIntoFirstUser(input, &ed)
+	}
+	if opts.InstructionsPrefix != "" && !hasDeveloperPrefix(input, opts.InstructionsPrefix) {
+		out = ed.Set(out, "instructions", common.PrefixInstructions(opts.InstructionsPrefix, gjson.Get(out, "instructions").String()))
+	}
 
 	// Map response_format and text settings to Responses API text.format
 	rf := gjson.GetBytes(rawJSON, "response_format")
@@ -238,49 +704,92 @@ func ConvertOpenAIRequestToCodex(modelName string, inputRawJSON []byte, stream b
 	if rf.Exists() {
 		// Always create text object when response_format provided
 		if !gjson.Get(out, "text").Exists() {
-			out, _ = sjson.SetRaw(out, "text", `{}`)
+			out = ed.SetRaw(out, "text", `{}`)
 		}
 
 		rft := rf.Get("type").String()
 		switch rft {
 		case "text":
-			out, _ = sjson.Set(out, "text.format.type", "text")
+			out = ed.Set(out, "text.format.type", "text")
 		case "json_schema":
 			js := rf.Get("json_schema")
 			if js.Exists() {
-				out, _ = sjson.Set(out, "text.format.type", "json_schema")
+				out = ed.Set(out, "text.format.type", "json_schema")
 				if v := js.Get("name"); v.Exists() {
-					out, _ = sjson.Set(out, "text.format.name", v.Value())
+					out = ed.Set(out, "text.format.name", v.Value())
 				}
 				if v := js.Get("strict"); v.Exists() {
-					out, _ = sjson.Set(out, "text.format.strict", v.Value())
+					out = ed.Set(out, "text.format.strict", v.Value())
 				}
 				if v := js.Get("schema"); v.Exists() {
-					out, _ = sjson.SetRaw(out, "text.format.schema", v.Raw)
+					if v.Type == gjson.String && gjson.Valid(v.String()) {
+						// Double-encoded schema: embed the decoded JSON rather than a string.
+						out = ed.SetRaw(out, "text.format.schema", v.String())
+					} else {
+						out = ed.SetRaw(out, "text.format.schema", v.Raw)
+					}
 				}
 			}
 		}
 
 		// Map verbosity if provided
 		if text.Exists() {
-			if v := text.Get("verbosity"); v.Exists() {
-				out, _ = sjson.Set(out, "text.verbosity", v.Value())
+			if v := text.Get("verbosity"); v.Exists() && v.Type != gjson.Null {
+				out = ed.Set(out, "text.verbosity", v.Value())
 			}
 		}
 	} else if text.Exists() {
 		// If only text.verbosity present (no response_format), map verbosity
-		if v := text.Get("verbosity"); v.Exists() {
+		if v := text.Get("verbosity"); v.Exists() && v.Type != gjson.Null {
 			if !gjson.Get(out, "text").Exists() {
-				out, _ = sjson.SetRaw(out, "text", `{}`)
+				out = ed.SetRaw(out, "text", `{}`)
+			}
+			out = ed.Set(out, "text.verbosity", v.Value())
+		}
+	}
+
+	// Text-only modalities are the Codex default and are stripped. Requests asking for audio are
+	// forwarded to audio-capable backends and rejected for everything else.
+	if modalities := gjson.GetBytes(rawJSON, "modalities"); modalities.IsArray() {
+		wantsAudio := false
+		for _, m := range modalities.Array() {
+			if m.String() == "audio" {
+				wantsAudio = true
 			}
-			out, _ = sjson.Set(out, "text.verbosity", v.Value())
+		}
+		if wantsAudio {
+			if common.LookupCapabilities(modelName).AudioOutput {
+				out = ed.SetRaw(out, "modalities", modalities.Raw)
+			} else {
+				fail(fmt.Errorf("model %s does not support audio output modalities", modelName))
+			}
+		}
+	}
+
+	// Forward the tool call budget to backends that honor it.
+	if v := gjson.GetBytes(rawJSON, "max_tool_calls"); v.Type == gjson.Number {
+		if common.LookupCapabilities(modelName).MaxToolCalls {
+			out = ed.Set(out, "max_tool_calls", v.Int())
+		} else {
+			log.Debugf("codex translator: dropping max_tool_calls unsupported by model %s", modelName)
+		}
+	}
+
+	// Map audio output configuration for backends that can produce audio.
+	if audio := gjson.GetBytes(rawJSON, "audio"); audio.IsObject() && common.LookupCapabilities(modelName).AudioOutput {
+		if v := audio.Get("voice"); v.Exists() {
+			out = ed.Set(out, "audio.voice", v.Value())
+		}
+		if v := audio.Get("format"); v.Exists() {
+			out = ed.Set(out, "audio.format", v.Value())
 		}
 	}
 
 	// Map tools (flatten function fields)
 	tools := gjson.GetBytes(rawJSON, "tools")
 	if tools.IsArray() && len(tools.Array()) > 0 {
-		out, _ = sjson.SetRaw(out, "tools", `[]`)
+		out = ed.SetRaw(out, "tools", `[]`)
+		seenToolNames := map[string]struct{}{}
 		arr := tools.Array()
 		for i := 0; i < len(arr); i++ {
 			t := arr[i]
@@ -288,36 +797,81 @@ func ConvertOpenAIRequestToCodex(modelName string, inputRawJSON []byte, stream b
 			// Pass through built-in tools (e.g. {"type":"web_search"}) directly for the Responses API.
 			// Only "function" needs structural conversion because Chat Completions nests details under "function".
 			if toolType != "" && toolType != "function" && t.IsObject() {
-				out, _ = sjson.SetRaw(out, "tools.-1", t.Raw)
+				if toolType == "file_search" && len(t.Get("vector_store_ids").Array()) == 0 {
+					// The backend rejects file_search without vector stores, so drop the tool.
+					log.Warnf("codex translator: dropping file_search tool without vector_store_ids")
+					fail(fmt.Errorf("file_search tool at index %d requires at least one vector_store_id", i))
+					count(common.EventToolDropped)
+					continue
+				}
+				out = ed.SetRaw(out, "tools.-1", normalizeBuiltinTool(t.Raw))
 				continue
 			}
 
 			if toolType == "function" {
 				item := `{}`
-				item, _ = sjson.Set(item, "type", "function")
+				item = ed.Set(item, "type", "function")
 				fn := t.Get("function")
 				if fn.Exists() {
 					if v := fn.Get("name"); v.Exists() {
 						name := v.String()
-						if short, ok := originalToolNameMap[name]; ok {
-							name = short
-						} else {
-							name = shortenNameIfNeeded(name)
+						if _, dup := seenToolNames[name]; dup {
+							// Codex rejects repeated tool names; keep the first definition.
+							log.Warnf("codex translator: dropping duplicate tool %q", name)
+							fail(fmt.Errorf("tools[%d]: duplicate tool name %q", i, name))
+							count(common.EventToolDropped)
+							continue
 						}
-						item, _ = sjson.Set(item, "name", name)
+						seenToolNames[name] = struct{}{}
+						short, ok := originalToolNameMap[name]
+						if !ok {
+							short = shortenNameIfNeeded(name)
+						}
+						if short != name {
+							count(common.EventToolNameShortened)
+						}
+						item = ed.Set(item, "name", short)
 					}
 					if v := fn.Get("description"); v.Exists() {
-						item, _ = sjson.Set(item, "description", v.Value())
+						item = ed.Set(item, "description", v.Value())
 					}
 					if v := fn.Get("parameters"); v.Exists() {
-						item, _ = sjson.SetRaw(item, "parameters", v.Raw)
+						params := v.Raw
+						if opts.InlineSchemaRefs {
+							if inlined, err := common.InlineSchemaRefs([]byte(params)); err == nil {
+								params = string(inlined)
+							} else {
+								log.Warnf("codex translator: forwarding parameters of tool %d with references: %v", i, err)
+							}
+						}
+						item = ed.SetRaw(item, "parameters", params)
 					}
 					if v := fn.Get("strict"); v.Exists() {
-						item, _ = sjson.Set(item, "strict", v.Value())
+						// A tool's own setting wins, so strict:false opts out of ForceStrictTools.
+						item = ed.Set(item, "strict", v.Value())
+					} else if opts.ForceStrictTools {
+						item = ed.Set(item, "strict", true)
 					}
 				}
-				out, _ = sjson.SetRaw(out, "tools.-1", item)
+				out = ed.SetRaw(out, "tools.-1", item)
+			}
+		}
+	}
+
+	// Enforce the tool count limit before tool_choice is matched against the remaining tools.
+	if n := int(gjson.Get(out, "tools.#").Int()); opts.MaxTools > 0 && n > opts.MaxTools {
+		if opts.TruncateTools {
+			log.Warnf("codex translator: keeping the first %d of %d tools", opts.MaxTools, n)
+			kept := `[]`
+			for _, tool := range gjson.Get(out, "tools").Array()[:opts.MaxTools] {
+				kept = ed.SetRaw(kept, "-1", tool.Raw)
 			}
+			out = ed.SetRaw(out, "tools", kept)
+			for i := opts.MaxTools; i < n; i++ {
+				count(common.EventToolDropped)
+			}
+		} else {
+			fail(fmt.Errorf("request declares %d tools, more than the limit of %d", n, opts.MaxTools))
 		}
 	}
 
@@ -327,7 +881,13 @@ func ConvertOpenAIRequestToCodex(modelName string, inputRawJSON []byte, stream b
 	if tc := gjson.GetBytes(rawJSON, "tool_choice"); tc.Exists() {
 		switch {
 		case tc.Type == gjson.String:
-			out, _ = sjson.Set(out, "tool_choice", tc.String())
+			if tc.String() == "required" && len(gjson.Get(out, "tools").Array()) == 0 {
+				// Requiring a tool call with no tools is unsatisfiable; Codex rejects it, so omit
+				// the constraint and let the backend answer normally.
+				fail(fmt.Errorf("tool_choice \"required\" needs at least one tool"))
+				break
+			}
+			out = ed.Set(out, "tool_choice", tc.String())
 		case tc.IsObject():
 			tcType := tc.Get("type").String()
 			if tcType == "function" {
@@ -340,20 +900,552 @@ func ConvertOpenAIRequestToCodex(modelName string, inputRawJSON []byte, stream b
 					}
 				}
 				choice := `{}`
-				choice, _ = sjson.Set(choice, "type", "function")
+				choice = ed.Set(choice, "type", "function")
 				if name != "" {
-					choice, _ = sjson.Set(choice, "name", name)
+					choice = ed.Set(choice, "name", name)
 				}
-				out, _ = sjson.SetRaw(out, "tool_choice", choice)
+				out = ed.SetRaw(out, "tool_choice", choice)
 			} else if tcType != "" {
 				// Built-in tool choices (e.g. {"type":"web_search"}) are already Responses-compatible.
-				out, _ = sjson.SetRaw(out, "tool_choice", tc.Raw)
+				choice := tc.Raw
+				if tcType == "web_search_preview" {
+					choice = ed.Set(choice, "type", "web_search")
+					tcType = "web_search"
+				}
+				// Codex rejects a choice naming a built-in tool the request does not declare, so
+				// omit it in that case. allowed_tools selects among declared tools by itself.
+				if tcType != "allowed_tools" && !gjson.Get(out, fmt.Sprintf("tools.#(type==%q)", tcType)).Exists() {
+					log.Warnf("codex translator: dropping tool_choice %q without a matching tool", tcType)
+					fail(fmt.Errorf("tool_choice %q has no matching tool in tools", tcType))
+					break
+				}
+				out = ed.SetRaw(out, "tool_choice", choice)
 			}
 		}
 	}
 
-	out, _ = sjson.Set(out, "store", false)
-	return []byte(out)
+	// Copy fields that are not part of the Chat Completions API (vendor extensions) verbatim.
+	if opts.PreserveUnknownFields {
+		gjson.ParseBytes(rawJSON).ForEach(func(key, value gjson.Result) bool {
+			name := key.String()
+			_, handled := requestFieldTargets[name]
+			if !handled && !common.IsDroppedField(name) && !gjson.Get(out, common.EscapePathKey(name)).Exists() {
+				out = ed.SetRaw(out, common.EscapePathKey(name), value.Raw)
+			}
+			return true
+		})
+	}
+
+	// A structured output schema combined with a forced tool call leaves the backend two
+	// contradictory instructions for the same turn.
+	if opts.RejectFormatToolChoiceConflict && gjson.Get(out, "text.format.type").String() == "json_schema" {
+		if tc := gjson.Get(out, "tool_choice"); tc.IsObject() || tc.String() == "required" {
+			fail(fmt.Errorf("response_format json_schema cannot be combined with a forced tool_choice"))
+		}
+	}
+
+	switch opts.Truncation {
+	case "":
+	case "auto", "disabled":
+		out = ed.Set(out, "truncation", opts.Truncation)
+	default:
+		fail(fmt.Errorf("unsupported truncation strategy %q", opts.Truncation))
+	}
+
+	if opts.CodexCompatFields {
+		for _, field := range codexCompatFields {
+			if !gjson.Get(out, field.path).Exists() {
+				out = ed.SetRaw(out, field.path, field.raw)
+			}
+		}
+	}
+
+	if opts.CorrelationID != "" {
+		out = ed.Set(out, "metadata.correlation_id", opts.CorrelationID)
+	}
+
+	out = ed.Set(out, "store", false)
+
+	// doc only holds an empty input array, so each spliced item is checked as well.
+	input, err := validInputItems(input)
+	fail(err)
+
+	// A field counts as stripped unless it was mapped, consumed by an option, or landed in the
+	// output unchanged (PreserveUnknownFields, ForwardSeed, ...).
+	if isObject && opts.Counters != nil {
+		gjson.ParseBytes(rawJSON).ForEach(func(key, value gjson.Result) bool {
+			name := key.String()
+			if _, ok := requestFieldTargets[name]; ok || consumed[name] {
+				return true
+			}
+			if landed := gjson.Get(out, common.EscapePathKey(name)); !landed.Exists() || landed.Raw != value.Raw {
+				count(common.EventFieldStripped)
+			}
+			return true
+		})
+	}
+	if err := ed.Finish([]byte(out)); err != nil {
+		fail(err)
+	}
+	return codexRequest{doc: out, input: input}, convErr
+}
+
+// argumentsString returns tool call arguments in the stringified JSON form Codex expects.
+// Arguments are normally already a string; clients that send a JSON object or array instead
+// get it compacted into a string rather than coerced.
+func argumentsString(args gjson.Result) string {
+	if args.IsObject() || args.IsArray() {
+		var buf bytes.Buffer
+		if err := json.Compact(&buf, []byte(args.Raw)); err == nil {
+			return buf.String()
+		}
+		return args.Raw
+	}
+	return args.String()
+}
+
+// synthesizeCallID derives a stable call ID from the item position, tool name and arguments for
+// calls and results that arrive without one.
+func synthesizeCallID(index int, name, arguments string) string {
+	sum := sha256.Sum256([]byte(fmt.Sprintf("%d\x00%s\x00%s", index, name, arguments)))
+	return "call_" + hex.EncodeToString(sum[:])[:24]
+}
+
+// generatedImageResult extracts the base64 payload of a data URL image, which is the form an
+// image_generation_call result takes. Other URLs cannot be replayed as generated images.
+func generatedImageResult(imageURL string) (string, bool) {
+	if !strings.HasPrefix(imageURL, "data:") {
+		return "", false
+	}
+	meta, data, ok := strings.Cut(strings.TrimPrefix(imageURL, "data:"), ",")
+	if !ok || !strings.HasSuffix(meta, ";base64") || data == "" {
+		return "", false
+	}
+	return data, true
+}
+
+// generatedImageID derives a stable image_generation_call id from the image data, so replays of
+// the same conversation produce the same item.
+func generatedImageID(result string) string {
+	sum := sha256.Sum256([]byte(result))
+	return "ig_" + hex.EncodeToString(sum[:])[:24]
+}
+
+// isLegacyFunctionsRequest reports whether the request uses the pre-tools "functions" field
+// without also providing "tools".
+func isLegacyFunctionsRequest(rawJSON []byte) bool {
+	return gjson.GetBytes(rawJSON, "functions").IsArray() && !gjson.GetBytes(rawJSON, "tools").Exists()
+}
+
+// legacyFunctionsToTools rewrites a legacy request's "functions" into function tools and its
+// top-level "function_call" into the equivalent "tool_choice". The input slice is not modified.
+func legacyFunctionsToTools(rawJSON []byte) []byte {
+	tools := `[]`
+	for _, fn := range gjson.GetBytes(rawJSON, "functions").Array() {
+		tool := `{"type":"function"}`
+		tool, _ = sjson.SetRaw(tool, "function", fn.Raw)
+		tools, _ = sjson.SetRaw(tools, "-1", tool)
+	}
+	result, _ := sjson.SetRawBytes(rawJSON, "tools", []byte(tools))
+
+	if fc := gjson.GetBytes(rawJSON, "function_call"); fc.Exists() && !gjson.GetBytes(rawJSON, "tool_choice").Exists() {
+		switch {
+		case fc.Type == gjson.String:
+			result, _ = sjson.SetBytes(result, "tool_choice", fc.String())
+		case fc.IsObject():
+			choice := `{"type":"function"}`
+			choice, _ = sjson.Set(choice, "function.name", fc.Get("name").String())
+			result, _ = sjson.SetRawBytes(result, "tool_choice", []byte(choice))
+		}
+	}
+	return result
+}
+
+// systemText returns the text of a system message's content: the string itself, or its text
+// parts joined by newlines.
+func systemText(content gjson.Result) string {
+	if content.Type == gjson.String {
+		return content.String()
+	}
+	if content.IsObject() {
+		return content.Get("text").String()
+	}
+	var texts []string
+	for _, part := range content.Array() {
+		switch strings.ToLower(strings.TrimSpace(part.Get("type").String())) {
+		case "text", "input_text":
+			texts = append(texts, part.Get("text").String())
+		}
+	}
+	return strings.Join(texts, "\n")
+}
+
+// hasDeveloperPrefix reports whether a developer message in input already starts with prefix,
+// which happens when a client replays a conversation that carried the preamble as a system
+// message.
+func hasDeveloperPrefix(input []string, prefix string) bool {
+	for _, raw := range input {
+		item := gjson.Parse(raw)
+		if item.Get("type").String() == "message" && item.Get("role").String() == "developer" &&
+			strings.HasPrefix(item.Get("content.0.text").String(), prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+// validInputItems drops input items that are not valid JSON, so the serialized request stays
+// valid, and reports the first one dropped.
+func validInputItems(input []string) ([]string, error) {
+	var err error
+	valid := input[:0]
+	for i, item := range input {
+		if !gjson.Valid(item) {
+			if err == nil {
+				err = fmt.Errorf("input item %d is not valid JSON", i)
+			}
+			continue
+		}
+		valid = append(valid, item)
+	}
+	return valid, err
+}
+
+// injectDefaultInstructions prepends a developer message holding instructions when the
+// converted input carries no developer message of its own.
+func injectDefaultInstructions(input []string, instructions string, ed *common.JSONEditor) []string {
+	for _, raw := range input {
+		item := gjson.Parse(raw)
+		if item.Get("type").String() == "message" && item.Get("role").String() == "developer" {
+			return input
+		}
+	}
+	msg := ed.Set(`{"type":"message","role":"developer","content":[{"type":"input_text","text":""}]}`, "content.0.text", instructions)
+	return append([]string{msg}, input...)
+}
+
+// inlineSystemIntoFirstUser removes developer messages from the input and prepends their text to
+// the first user message, for backends without developer/system role support. The text is
+// merged into the user's leading input_text part, or added as a new leading part when the
+// message starts with something else. Without any user message the text becomes one.
+func inlineSystemIntoFirstUser(input []string, ed *common.JSONEditor) []string {
+	var systemTexts []string
+	for _, raw := range input {
+		item := gjson.Parse(raw)
+		if item.Get("type").String() == "message" && item.Get("role").String() == "developer" {
+			for _, part := range item.Get("content").Array() {
+				if text := part.Get("text").String(); text != "" {
+					systemTexts = append(systemTexts, text)
+				}
+			}
+		}
+	}
+	if len(systemTexts) == 0 {
+		return input
+	}
+	systemText := strings.Join(systemTexts, "\n\n")
+
+	result := make([]string, 0, len(input))
+	inlined := false
+	for _, raw := range input {
+		item := gjson.Parse(raw)
+		if item.Get("type").String() == "message" && item.Get("role").String() == "developer" {
+			continue
+		}
+		if !inlined && item.Get("type").String() == "message" && item.Get("role").String() == "user" {
+			if first := item.Get("content.0"); first.Get("type").String() == "input_text" {
+				raw = ed.Set(raw, "content.0.text", systemText+"\n\n"+first.Get("text").String())
+			} else {
+				content := `[]`
+				content = ed.SetRaw(content, "-1", ed.Set(`{"type":"input_text"}`, "text", systemText))
+				for _, existing := range item.Get("content").Array() {
+					content = ed.SetRaw(content, "-1", existing.Raw)
+				}
+				raw = ed.SetRaw(raw, "content", content)
+			}
+			inlined = true
+		}
+		result = append(result, raw)
+	}
+	if !inlined {
+		msg := ed.Set(`{"type":"message","role":"user","content":[{"type":"input_text"}]}`, "content.0.text", systemText)
+		result = append([]string{msg}, result...)
+	}
+	return result
+}
+
+// groupFunctionCallItems rewrites each run of consecutive function_call/function_call_output
+// items so that all calls come first, followed by their outputs in call order. Only tool-only
+// runs are reordered, so messages never move relative to each other and every output still
+// follows its call. Outputs whose call is not part of the run keep their relative order at
+// the end of the run.
+func groupFunctionCallItems(input []string) []string {
+	items := make([]gjson.Result, len(input))
+	for i, raw := range input {
+		items[i] = gjson.Parse(raw)
+	}
+	isToolItem := func(item gjson.Result) bool {
+		t := item.Get("type").String()
+		return t == "function_call" || t == "function_call_output"
+	}
+
+	result := make([]string, 0, len(input))
+	for i := 0; i < len(items); {
+		if !isToolItem(items[i]) {
+			result = append(result, items[i].Raw)
+			i++
+			continue
+		}
+		end := i
+		for end < len(items) && isToolItem(items[end]) {
+			end++
+		}
+		var calls []gjson.Result
+		outputs := map[string][]gjson.Result{}
+		var unmatched []gjson.Result
+		for _, item := range items[i:end] {
+			if item.Get("type").String() == "function_call" {
+				calls = append(calls, item)
+			} else {
+				callID := item.Get("call_id").String()
+				outputs[callID] = append(outputs[callID], item)
+			}
+		}
+		for _, call := range calls {
+			result = append(result, call.Raw)
+		}
+		for _, call := range calls {
+			callID := call.Get("call_id").String()
+			for _, output := range outputs[callID] {
+				result = append(result, output.Raw)
+			}
+			delete(outputs, callID)
+		}
+		for _, item := range items[i:end] {
+			if item.Get("type").String() != "function_call_output" {
+				continue
+			}
+			if _, ok := outputs[item.Get("call_id").String()]; ok {
+				unmatched = append(unmatched, item)
+			}
+		}
+		for _, item := range unmatched {
+			result = append(result, item.Raw)
+		}
+		i = end
+	}
+	return result
+}
+
+// normalizeBuiltinTool prepares a built-in tool definition for the Responses API. Nested
+// configuration (e.g. web_search user_location and search_context_size) is kept as-is; legacy
+// tool types are renamed to their current equivalents and required fields get defaults.
+func normalizeBuiltinTool(raw string) string {
+	switch gjson.Get(raw, "type").String() {
+	case "web_search_preview":
+		raw, _ = sjson.Set(raw, "type", "web_search")
+	case "code_interpreter":
+		// The Responses API requires a container; let the backend allocate one by default.
+		if !gjson.Get(raw, "container").Exists() {
+			raw, _ = sjson.SetRaw(raw, "container", `{"type":"auto"}`)
+		}
+	}
+	return raw
+}
+
+// inlineToolCallPattern finds where an inline {"tool_call": ...} block may start.
+var inlineToolCallPattern = regexp.MustCompile(`\{\s*"tool_call"\s*:`)
+
+// maxInlineToolCallAttempts bounds how many candidate blocks one text is decoded from, so text
+// full of malformed candidates cannot make the scan quadratic.
+const maxInlineToolCallAttempts = 64
+
+// extractInlineToolCalls removes well-formed {"tool_call": {...}} JSON blocks from assistant text
+// and returns them as tool-call-shaped values. Models without native tool support sometimes
+// emit calls this way. Only positions matching inlineToolCallPattern are decoded. Blocks keep
+// their id when they carry one; otherwise the id is left empty so the call receives a
+// synthesized one that tool results without an id are paired with. Text without such blocks is
+// returned unchanged.
+func extractInlineToolCalls(text string) (string, []gjson.Result) {
+	var calls []gjson.Result
+	var remaining strings.Builder
+	rest := text
+	for attempts := 0; attempts < maxInlineToolCallAttempts; attempts++ {
+		loc := inlineToolCallPattern.FindStringIndex(rest)
+		if loc == nil {
+			break
+		}
+		start := loc[0]
+		dec := json.NewDecoder(strings.NewReader(rest[start:]))
+		var block json.RawMessage
+		if err := dec.Decode(&block); err != nil {
+			remaining.WriteString(rest[:loc[1]])
+			rest = rest[loc[1]:]
+			continue
+		}
+		end := start + int(dec.InputOffset())
+		call := gjson.GetBytes(block, "tool_call")
+		if !call.IsObject() || (call.Get("name").String() == "" && call.Get("function.name").String() == "") {
+			remaining.WriteString(rest[:end])
+			rest = rest[end:]
+			continue
+		}
+		calls = append(calls, call)
+		remaining.WriteString(rest[:start])
+		rest = rest[end:]
+	}
+	remaining.WriteString(rest)
+	if len(calls) == 0 {
+		return text, nil
+	}
+	return strings.TrimSpace(remaining.String()), calls
+}
+
+// sortToolCallsByIndex orders tool calls by their "index" field, which streaming-accumulated
+// messages carry and which may disagree with array order. When any entry lacks an index the
+// original array order is kept.
+func sortToolCallsByIndex(toolCalls []gjson.Result) []gjson.Result {
+	for _, tc := range toolCalls {
+		if tc.Get("index").Type != gjson.Number {
+			return toolCalls
+		}
+	}
+	sort.SliceStable(toolCalls, func(i, j int) bool {
+		return toolCalls[i].Get("index").Int() < toolCalls[j].Get("index").Int()
+	})
+	return toolCalls
+}
+
+// toolOutputWithImages converts a tool message content array holding at least one image part
+// into the structured function_call_output form Codex accepts. It reports false when the
+// content carries no forwardable image, leaving the caller to send a plain string.
+func toolOutputWithImages(content gjson.Result, messageIndex int, opts Options) (string, bool, error) {
+	if !content.IsArray() {
+		return "", false, nil
+	}
+	items := `[]`
+	hasImage := false
+	var firstErr error
+	for j, part := range content.Array() {
+		switch strings.ToLower(strings.TrimSpace(part.Get("type").String())) {
+		case "text", "input_text":
+			item := `{"type":"input_text"}`
+			item, _ = sjson.Set(item, "text", part.Get("text").String())
+			items, _ = sjson.SetRaw(items, "-1", item)
+		case "image_url", "input_image":
+			imageURL := part.Get("image_url.url")
+			if !imageURL.Exists() {
+				imageURL = part.Get("image_url")
+			}
+			if imageURL.Type != gjson.String || !isForwardableImageURL(imageURL.String()) {
+				continue
+			}
+			if size, ok := common.DataURLSize(imageURL.String()); ok && opts.MaxImageBytes > 0 && size > opts.MaxImageBytes {
+				// The result stays structured even when its image is dropped, so the data URL
+				// is never stringified into the output.
+				hasImage = true
+				if opts.DropOversizedImages {
+					log.Warnf("codex translator: dropping %d byte image in tool result %d", size, messageIndex)
+					continue
+				}
+				if firstErr == nil {
+					firstErr = fmt.Errorf("messages[%d].content[%d]: image is %d bytes, more than the limit of %d", messageIndex, j, size, opts.MaxImageBytes)
+				}
+			}
+			item := `{"type":"input_image"}`
+			item, _ = sjson.Set(item, "image_url", imageURL.String())
+			if detail := part.Get("image_url.detail"); detail.Exists() {
+				item, _ = sjson.Set(item, "detail", detail.String())
+			} else if detail = part.Get("detail"); detail.Exists() {
+				item, _ = sjson.Set(item, "detail", detail.String())
+			}
+			items, _ = sjson.SetRaw(items, "-1", item)
+			hasImage = true
+		}
+	}
+	return items, hasImage, firstErr
+}
+
+// outputTokenLimit returns the client's output token limit, preferring max_completion_tokens
+// over the deprecated max_tokens. Zero or negative values mean different things to different
+// clients ("no limit" or "no output"), so they are treated as if the field were omitted.
+func outputTokenLimit(rawJSON []byte) (int64, bool) {
+	for _, field := range []string{"max_completion_tokens", "max_tokens"} {
+		if v := gjson.GetBytes(rawJSON, field); v.Type == gjson.Number {
+			if v.Int() > 0 {
+				return v.Int(), true
+			}
+			return 0, false
+		}
+	}
+	return 0, false
+}
+
+// limitToolOutput enforces opts.MaxToolOutputBytes on a tool result, preferring the caller's
+// summarizer and falling back to truncation at a UTF-8 boundary.
+func limitToolOutput(output string, opts Options) string {
+	limit := opts.MaxToolOutputBytes
+	if limit <= 0 || len(output) <= limit {
+		return output
+	}
+	if opts.ToolOutputSummarizer != nil {
+		output = opts.ToolOutputSummarizer(output)
+		if len(output) <= limit {
+			return output
+		}
+	}
+	cut := limit
+	for cut > 0 && !utf8.RuneStart(output[cut]) {
+		cut--
+	}
+	return output[:cut]
+}
+
+// isForwardableImageURL reports whether an image URL uses a scheme Codex can fetch. Local paths
+// and file:// URLs only make sense on the client and are rejected upstream.
+func isForwardableImageURL(raw string) bool {
+	u, err := url.Parse(strings.TrimSpace(raw))
+	if err != nil {
+		return false
+	}
+	switch strings.ToLower(u.Scheme) {
+	case "http", "https", "data":
+		return true
+	}
+	return false
+}
+
+// splitImageParts breaks a message holding more than one input_image part into consecutive
+// messages with at most one image each. Parts keep their original order; a new message is
+// started whenever an image would otherwise join a message that already has one.
+func splitImageParts(msg string, ed *common.JSONEditor) []string {
+	parts := gjson.Get(msg, "content").Array()
+	images := 0
+	for _, part := range parts {
+		if part.Get("type").String() == "input_image" {
+			images++
+		}
+	}
+	if images <= 1 {
+		return []string{msg}
+	}
+
+	var messages []string
+	current := ed.SetRaw(msg, "content", `[]`)
+	hasImage := false
+	for _, part := range parts {
+		isImage := part.Get("type").String() == "input_image"
+		if isImage && hasImage {
+			messages = append(messages, current)
+			current = ed.SetRaw(msg, "content", `[]`)
+			hasImage = false
+		}
+		current = ed.SetRaw(current, "content.-1", part.Raw)
+		if isImage {
+			hasImage = true
+		}
+	}
+	return append(messages, current)
 }
 
 func shortenCallID(id string) string {
@@ -374,6 +1466,33 @@ func shortenCallID(id string) string {
 	return prefix + hash
 }
 
+// CallIDMap returns the original -> shortened mapping for every tool call ID in a Chat
+// Completions request that ConvertOpenAIRequestToCodex shortens to fit the Codex limit. The
+// mapping is derived from the request alone, so response translators can rebuild it from the
+// original request to restore the client's IDs.
+func CallIDMap(rawJSON []byte) map[string]string {
+	ids := map[string]string{}
+	add := func(id string) {
+		if short := shortenCallID(id); short != id {
+			ids[id] = short
+		}
+	}
+	for _, m := range gjson.GetBytes(rawJSON, "messages").Array() {
+		add(m.Get("tool_call_id").String())
+		for _, tc := range m.Get("tool_calls").Array() {
+			add(tc.Get("id").String())
+		}
+		for _, part := range m.Get("content").Array() {
+			switch strings.ToLower(strings.TrimSpace(part.Get("type").String())) {
+			case "tool_call", "function_call":
+				add(part.Get("id").String())
+				add(part.Get("call_id").String())
+			}
+		}
+	}
+	return ids
+}
+
 // shortenNameIfNeeded applies the simple shortening rule for a single name.
 // If the name length exceeds 64, it will try to preserve the "mcp__" prefix and last segment.
 // Otherwise it truncates to 64 characters.
@@ -444,6 +1563,10 @@ func buildShortNameMap(names []string) map[string]string {
 	}
 
 	for _, n := range names {
+		if _, ok := m[n]; ok {
+			// Identical names must keep one short name so calls still match the tool.
+			continue
+		}
 		cand := baseCandidate(n)
 		uniq := makeUnique(cand)
 		used[uniq] = struct{}{}
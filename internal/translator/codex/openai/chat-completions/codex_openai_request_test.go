@@ -0,0 +1,2565 @@
+package chat_completions
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"runtime"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/router-for-me/CLIProxyAPI/v6/internal/translator/codex/common"
+	"github.com/tidwall/gjson"
+	"github.com/tidwall/sjson"
+)
+
+// TestConvertOpenAIRequestToCodex_ContentEmbeddedToolCalls tests that tool calls placed in the
+// assistant content array are emitted as function_call items after the message
+func TestConvertOpenAIRequestToCodex_ContentEmbeddedToolCalls(t *testing.T) {
+	inputJSON := []byte(`{
+		"model": "gpt-5.2",
+		"messages": [
+			{"role": "user", "content": "What's the weather in Paris and Rome?"},
+			{
+				"role": "assistant",
+				"content": [
+					{"type": "text", "text": "Checking both cities."},
+					{"type": "tool_call", "id": "call_paris", "function": {"name": "get_weather", "arguments": "{\"city\":\"Paris\"}"}},
+					{"type": "function_call", "call_id": "call_rome", "name": "get_weather", "arguments": "{\"city\":\"Rome\"}"}
+				]
+			},
+			{"role": "tool", "tool_call_id": "call_paris", "content": "sunny"},
+			{"role": "tool", "tool_call_id": "call_rome", "content": "rainy"}
+		]
+	}`)
+
+	output := ConvertOpenAIRequestToCodex("gpt-5.2", inputJSON, true)
+	input := gjson.GetBytes(output, "input").Array()
+
+	if len(input) != 6 {
+		t.Fatalf("Expected 6 input items, got %d: %s", len(input), gjson.GetBytes(output, "input").Raw)
+	}
+
+	assistant := input[1]
+	if assistant.Get("role").String() != "assistant" {
+		t.Fatalf("Expected assistant message at index 1, got %s", assistant.Raw)
+	}
+	if parts := assistant.Get("content").Array(); len(parts) != 1 || parts[0].Get("type").String() != "output_text" {
+		t.Errorf("Expected assistant content to keep only the text part, got %s", assistant.Get("content").Raw)
+	}
+
+	expected := []struct {
+		callID    string
+		arguments string
+	}{
+		{"call_paris", `{"city":"Paris"}`},
+		{"call_rome", `{"city":"Rome"}`},
+	}
+	for i, exp := range expected {
+		item := input[2+i]
+		if item.Get("type").String() != "function_call" {
+			t.Fatalf("Expected function_call at index %d, got %s", 2+i, item.Raw)
+		}
+		if item.Get("call_id").String() != exp.callID {
+			t.Errorf("Expected call_id %q, got %q", exp.callID, item.Get("call_id").String())
+		}
+		if item.Get("name").String() != "get_weather" {
+			t.Errorf("Expected name get_weather, got %q", item.Get("name").String())
+		}
+		if item.Get("arguments").String() != exp.arguments {
+			t.Errorf("Expected arguments %s, got %s", exp.arguments, item.Get("arguments").String())
+		}
+	}
+
+	if input[4].Get("call_id").String() != "call_paris" || input[5].Get("call_id").String() != "call_rome" {
+		t.Errorf("Expected function_call_output items to keep their call ids, got %s and %s", input[4].Raw, input[5].Raw)
+	}
+}
+
+// TestConvertOpenAIRequestToCodex_MixedCaseAndPaddedRoles tests that roles are normalized
+// before being classified
+func TestConvertOpenAIRequestToCodex_MixedCaseAndPaddedRoles(t *testing.T) {
+	inputJSON := []byte(`{
+		"model": "gpt-5.2",
+		"messages": [
+			{"role": "System", "content": "Be brief."},
+			{"role": " user", "content": "Hello"},
+			{"role": "Assistant ", "content": "Hi there"},
+			{"role": "TOOL", "tool_call_id": "call_1", "content": "done"}
+		]
+	}`)
+
+	output := ConvertOpenAIRequestToCodex("gpt-5.2", inputJSON, true)
+	input := gjson.GetBytes(output, "input").Array()
+	if len(input) != 4 {
+		t.Fatalf("Expected 4 input items, got %d", len(input))
+	}
+
+	if got := input[0].Get("role").String(); got != "developer" {
+		t.Errorf("Expected 'System' to map to developer, got %q", got)
+	}
+	if got := input[1].Get("role").String(); got != "user" {
+		t.Errorf("Expected ' user' to map to user, got %q", got)
+	}
+	if got := input[2].Get("role").String(); got != "assistant" {
+		t.Errorf("Expected 'Assistant ' to map to assistant, got %q", got)
+	}
+	if got := input[2].Get("content.0.type").String(); got != "output_text" {
+		t.Errorf("Expected assistant content to use output_text, got %q", got)
+	}
+	if got := input[3].Get("type").String(); got != "function_call_output" {
+		t.Errorf("Expected 'TOOL' to map to function_call_output, got %q", got)
+	}
+}
+
+// TestConvertOpenAIRequestToCodex_SplitImagesToSeparateMessages tests that a user message with
+// three images becomes three consecutive single-image user messages
+func TestConvertOpenAIRequestToCodex_SplitImagesToSeparateMessages(t *testing.T) {
+	inputJSON := []byte(`{
+		"model": "gpt-5.2",
+		"messages": [
+			{
+				"role": "user",
+				"content": [
+					{"type": "text", "text": "Compare these pictures."},
+					{"type": "image_url", "image_url": {"url": "https://example.com/1.png"}},
+					{"type": "image_url", "image_url": {"url": "https://example.com/2.png"}},
+					{"type": "image_url", "image_url": {"url": "https://example.com/3.png"}}
+				]
+			}
+		]
+	}`)
+
+	output, err := ConvertOpenAIRequestToCodexWithOptions("gpt-5.2", inputJSON, true, Options{SplitImagesToSeparateMessages: true})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	input := gjson.GetBytes(output, "input").Array()
+	if len(input) != 3 {
+		t.Fatalf("Expected 3 user messages, got %d: %s", len(input), gjson.GetBytes(output, "input").Raw)
+	}
+
+	for i, msg := range input {
+		if msg.Get("role").String() != "user" {
+			t.Errorf("Expected message %d to be a user message, got %q", i, msg.Get("role").String())
+		}
+		images := 0
+		for _, part := range msg.Get("content").Array() {
+			if part.Get("type").String() == "input_image" {
+				images++
+			}
+		}
+		if images != 1 {
+			t.Errorf("Expected exactly one image in message %d, got %d", i, images)
+		}
+		want := fmt.Sprintf("https://example.com/%d.png", i+1)
+		if got := msg.Get(`content.#(type=="input_image").image_url`).String(); got != want {
+			t.Errorf("Expected image %q in message %d, got %q", want, i, got)
+		}
+	}
+
+	if got := input[0].Get("content.0.text").String(); got != "Compare these pictures." {
+		t.Errorf("Expected leading text to stay with the first image, got %q", got)
+	}
+
+	unsplit := ConvertOpenAIRequestToCodex("gpt-5.2", inputJSON, true)
+	if n := len(gjson.GetBytes(unsplit, "input").Array()); n != 1 {
+		t.Errorf("Expected a single message without the option, got %d", n)
+	}
+}
+
+// TestConvertOpenAIRequestToCodex_BareStringImageURL tests that a string-valued image_url is
+// treated as the image URL
+func TestConvertOpenAIRequestToCodex_BareStringImageURL(t *testing.T) {
+	inputJSON := []byte(`{
+		"model": "gpt-5.2",
+		"messages": [
+			{
+				"role": "user",
+				"content": [
+					{"type": "text", "text": "Describe this."},
+					{"type": "image_url", "image_url": "https://example.com/photo.jpg"}
+				]
+			}
+		]
+	}`)
+
+	output := ConvertOpenAIRequestToCodex("gpt-5.2", inputJSON, true)
+
+	part := gjson.GetBytes(output, "input.0.content.1")
+	if part.Get("type").String() != "input_image" {
+		t.Fatalf("Expected input_image part, got %s", part.Raw)
+	}
+	if got := part.Get("image_url").String(); got != "https://example.com/photo.jpg" {
+		t.Errorf("Expected bare-string URL to be used, got %q", got)
+	}
+}
+
+// TestConvertOpenAIRequestToCodex_ToolCallsSortedByIndex tests that tool calls are emitted in
+// index order when the index disagrees with array order
+func TestConvertOpenAIRequestToCodex_ToolCallsSortedByIndex(t *testing.T) {
+	inputJSON := []byte(`{
+		"model": "gpt-5.2",
+		"messages": [
+			{"role": "user", "content": "Run all three."},
+			{
+				"role": "assistant",
+				"content": null,
+				"tool_calls": [
+					{"index": 2, "id": "call_c", "type": "function", "function": {"name": "step", "arguments": "{\"n\":3}"}},
+					{"index": 0, "id": "call_a", "type": "function", "function": {"name": "step", "arguments": "{\"n\":1}"}},
+					{"index": 1, "id": "call_b", "type": "function", "function": {"name": "step", "arguments": "{\"n\":2}"}}
+				]
+			}
+		]
+	}`)
+
+	output := ConvertOpenAIRequestToCodex("gpt-5.2", inputJSON, true)
+
+	var callIDs []string
+	for _, item := range gjson.GetBytes(output, "input").Array() {
+		if item.Get("type").String() == "function_call" {
+			callIDs = append(callIDs, item.Get("call_id").String())
+		}
+	}
+	expected := []string{"call_a", "call_b", "call_c"}
+	if fmt.Sprint(callIDs) != fmt.Sprint(expected) {
+		t.Errorf("Expected function calls in index order %v, got %v", expected, callIDs)
+	}
+}
+
+// TestConvertOpenAIRequestToCodex_ParseInlineToolCalls tests that an inline tool call block in
+// assistant text becomes a function_call item and plain text is left untouched
+func TestConvertOpenAIRequestToCodex_ParseInlineToolCalls(t *testing.T) {
+	inputJSON := []byte(`{
+		"model": "gpt-5.2",
+		"messages": [
+			{"role": "user", "content": "What's the weather?"},
+			{"role": "assistant", "content": "Let me check. {\"tool_call\": {\"name\": \"get_weather\", \"arguments\": {\"city\": \"Paris\"}}}"},
+			{"role": "assistant", "content": "Plain answer with {braces} but no call."}
+		]
+	}`)
+
+	output, err := ConvertOpenAIRequestToCodexWithOptions("gpt-5.2", inputJSON, true, Options{ParseInlineToolCalls: true})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	input := gjson.GetBytes(output, "input").Array()
+	if len(input) != 4 {
+		t.Fatalf("Expected 4 input items, got %d: %s", len(input), gjson.GetBytes(output, "input").Raw)
+	}
+
+	if got := input[1].Get("content.0.text").String(); got != "Let me check." {
+		t.Errorf("Expected tool call block to be removed from text, got %q", got)
+	}
+
+	call := input[2]
+	if call.Get("type").String() != "function_call" {
+		t.Fatalf("Expected function_call item, got %s", call.Raw)
+	}
+	if call.Get("name").String() != "get_weather" {
+		t.Errorf("Expected name get_weather, got %q", call.Get("name").String())
+	}
+	if !gjson.Valid(call.Get("arguments").String()) || gjson.Get(call.Get("arguments").String(), "city").String() != "Paris" {
+		t.Errorf("Expected arguments to carry city Paris, got %s", call.Get("arguments").Raw)
+	}
+	if call.Get("call_id").String() == "" {
+		t.Error("Expected a synthesized call_id for the inline tool call")
+	}
+
+	if got := input[3].Get("content.0.text").String(); got != "Plain answer with {braces} but no call." {
+		t.Errorf("Expected plain text to be untouched, got %q", got)
+	}
+
+	disabled := ConvertOpenAIRequestToCodex("gpt-5.2", inputJSON, true)
+	if n := len(gjson.GetBytes(disabled, "input").Array()); n != 3 {
+		t.Errorf("Expected inline tool calls to be ignored without the option, got %d items", n)
+	}
+}
+
+// TestConvertOpenAIRequestToCodex_WebSearchToolConfigPreserved tests that web_search nested
+// configuration survives the built-in tool passthrough
+func TestConvertOpenAIRequestToCodex_WebSearchToolConfigPreserved(t *testing.T) {
+	inputJSON := []byte(`{
+		"model": "gpt-5.2",
+		"messages": [{"role": "user", "content": "Latest news?"}],
+		"tools": [{
+			"type": "web_search",
+			"search_context_size": "high",
+			"user_location": {"type": "approximate", "country": "GB", "city": "London"}
+		}]
+	}`)
+
+	output := ConvertOpenAIRequestToCodex("gpt-5.2", inputJSON, true)
+
+	tool := gjson.GetBytes(output, "tools.0")
+	if tool.Get("type").String() != "web_search" {
+		t.Errorf("Expected web_search tool, got %s", tool.Raw)
+	}
+	if got := tool.Get("search_context_size").String(); got != "high" {
+		t.Errorf("Expected search_context_size 'high', got %q", got)
+	}
+	if got := tool.Get("user_location.city").String(); got != "London" {
+		t.Errorf("Expected user_location.city 'London', got %q", got)
+	}
+	if got := tool.Get("user_location.country").String(); got != "GB" {
+		t.Errorf("Expected user_location.country 'GB', got %q", got)
+	}
+}
+
+// TestConvertOpenAIRequestToCodex_WebSearchPreviewNormalized tests that the legacy
+// web_search_preview type is renamed to web_search for tools and tool_choice
+func TestConvertOpenAIRequestToCodex_WebSearchPreviewNormalized(t *testing.T) {
+	inputJSON := []byte(`{
+		"model": "gpt-5.2",
+		"messages": [{"role": "user", "content": "Latest news?"}],
+		"tools": [{"type": "web_search_preview", "search_context_size": "low"}],
+		"tool_choice": {"type": "web_search_preview"}
+	}`)
+
+	output := ConvertOpenAIRequestToCodex("gpt-5.2", inputJSON, true)
+
+	if got := gjson.GetBytes(output, "tools.0.type").String(); got != "web_search" {
+		t.Errorf("Expected tool type web_search, got %q", got)
+	}
+	if got := gjson.GetBytes(output, "tools.0.search_context_size").String(); got != "low" {
+		t.Errorf("Expected search_context_size to survive normalization, got %q", got)
+	}
+	if got := gjson.GetBytes(output, "tool_choice.type").String(); got != "web_search" {
+		t.Errorf("Expected tool_choice type web_search, got %q", got)
+	}
+}
+
+// TestConvertOpenAIRequestToCodex_GroupFunctionCalls tests that interleaved call/output items
+// are grouped while every call keeps a matching output after it
+func TestConvertOpenAIRequestToCodex_GroupFunctionCalls(t *testing.T) {
+	inputJSON := []byte(`{
+		"model": "gpt-5.2",
+		"messages": [
+			{"role": "user", "content": "Weather in Paris and Rome?"},
+			{"role": "assistant", "content": null, "tool_calls": [{"id": "call_a", "type": "function", "function": {"name": "get_weather", "arguments": "{\"city\":\"Paris\"}"}}]},
+			{"role": "tool", "tool_call_id": "call_a", "content": "sunny"},
+			{"role": "assistant", "content": null, "tool_calls": [{"id": "call_b", "type": "function", "function": {"name": "get_weather", "arguments": "{\"city\":\"Rome\"}"}}]},
+			{"role": "tool", "tool_call_id": "call_b", "content": "rainy"},
+			{"role": "assistant", "content": "Paris is sunny, Rome is rainy."}
+		]
+	}`)
+
+	output, err := ConvertOpenAIRequestToCodexWithOptions("gpt-5.2", inputJSON, true, Options{GroupFunctionCalls: true})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if !gjson.ValidBytes(output) {
+		t.Fatalf("Expected valid JSON output, got %s", output)
+	}
+
+	var sequence []string
+	for _, item := range gjson.GetBytes(output, "input").Array() {
+		switch item.Get("type").String() {
+		case "function_call":
+			sequence = append(sequence, "call:"+item.Get("call_id").String())
+		case "function_call_output":
+			sequence = append(sequence, "output:"+item.Get("call_id").String())
+		default:
+			sequence = append(sequence, item.Get("role").String())
+		}
+	}
+
+	// The empty assistant messages that carried the tool calls split the runs, so each call is
+	// immediately followed by its output; the structure must stay intact.
+	expected := []string{"user", "assistant", "call:call_a", "output:call_a", "assistant", "call:call_b", "output:call_b", "assistant"}
+	if fmt.Sprint(sequence) != fmt.Sprint(expected) {
+		t.Fatalf("Expected sequence %v, got %v", expected, sequence)
+	}
+
+	interleaved := []byte(`{
+		"model": "gpt-5.2",
+		"messages": [
+			{"role": "user", "content": "Weather in Paris and Rome?"},
+			{"role": "assistant", "content": [
+				{"type": "tool_call", "id": "call_a", "function": {"name": "get_weather", "arguments": "{}"}},
+				{"type": "tool_call", "id": "call_b", "function": {"name": "get_weather", "arguments": "{}"}}
+			]},
+			{"role": "tool", "tool_call_id": "call_b", "content": "rainy"},
+			{"role": "tool", "tool_call_id": "call_a", "content": "sunny"}
+		]
+	}`)
+	output, err = ConvertOpenAIRequestToCodexWithOptions("gpt-5.2", interleaved, true, Options{GroupFunctionCalls: true})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	sequence = nil
+	for _, item := range gjson.GetBytes(output, "input").Array() {
+		if id := item.Get("call_id").String(); id != "" {
+			sequence = append(sequence, item.Get("type").String()+":"+id)
+		}
+	}
+	expected = []string{"function_call:call_a", "function_call:call_b", "function_call_output:call_a", "function_call_output:call_b"}
+	if fmt.Sprint(sequence) != fmt.Sprint(expected) {
+		t.Errorf("Expected grouped calls followed by outputs in call order %v, got %v", expected, sequence)
+	}
+}
+
+// TestConvertOpenAIRequestToCodex_CodeInterpreterContainer tests that a bare code_interpreter
+// tool gets a default container while an explicit container is preserved
+func TestConvertOpenAIRequestToCodex_CodeInterpreterContainer(t *testing.T) {
+	inputJSON := []byte(`{
+		"model": "gpt-5.2",
+		"messages": [{"role": "user", "content": "Plot a sine wave."}],
+		"tools": [
+			{"type": "code_interpreter"},
+			{"type": "code_interpreter", "container": "cntr_123"}
+		]
+	}`)
+
+	output := ConvertOpenAIRequestToCodex("gpt-5.2", inputJSON, true)
+
+	if got := gjson.GetBytes(output, "tools.0.container.type").String(); got != "auto" {
+		t.Errorf("Expected default container type 'auto', got %s", gjson.GetBytes(output, "tools.0.container").Raw)
+	}
+	if got := gjson.GetBytes(output, "tools.1.container").String(); got != "cntr_123" {
+		t.Errorf("Expected explicit container to be preserved, got %s", gjson.GetBytes(output, "tools.1.container").Raw)
+	}
+}
+
+// TestConvertOpenAIRequestToCodex_InputImagePart tests that Responses-shaped input_image parts
+// in a Chat Completions message are forwarded
+func TestConvertOpenAIRequestToCodex_InputImagePart(t *testing.T) {
+	inputJSON := []byte(`{
+		"model": "gpt-5.2",
+		"messages": [
+			{
+				"role": "user",
+				"content": [
+					{"type": "text", "text": "What is this?"},
+					{"type": "input_image", "image_url": "https://example.com/shim.png", "detail": "low"}
+				]
+			}
+		]
+	}`)
+
+	output := ConvertOpenAIRequestToCodex("gpt-5.2", inputJSON, true)
+
+	part := gjson.GetBytes(output, "input.0.content.1")
+	if part.Get("type").String() != "input_image" {
+		t.Fatalf("Expected input_image part, got %s", gjson.GetBytes(output, "input.0.content").Raw)
+	}
+	if got := part.Get("image_url").String(); got != "https://example.com/shim.png" {
+		t.Errorf("Expected image_url to be forwarded, got %q", got)
+	}
+	if got := part.Get("detail").String(); got != "low" {
+		t.Errorf("Expected detail to be forwarded, got %q", got)
+	}
+}
+
+// TestConvertOpenAIRequestToCodexE_FileSearchVectorStores tests that file_search configuration is
+// preserved and that an empty vector store list is rejected by the strict variant
+func TestConvertOpenAIRequestToCodexE_FileSearchVectorStores(t *testing.T) {
+	validJSON := []byte(`{
+		"model": "gpt-5.2",
+		"messages": [{"role": "user", "content": "Search my docs."}],
+		"tools": [{"type": "file_search", "vector_store_ids": ["vs_123", "vs_456"], "max_num_results": 5}]
+	}`)
+
+	output, err := ConvertOpenAIRequestToCodexE("gpt-5.2", validJSON, true)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	tool := gjson.GetBytes(output, "tools.0")
+	if got := tool.Get("vector_store_ids").Raw; got != `["vs_123", "vs_456"]` {
+		t.Errorf("Expected vector_store_ids to be preserved, got %s", got)
+	}
+	if got := tool.Get("max_num_results").Int(); got != 5 {
+		t.Errorf("Expected max_num_results 5, got %d", got)
+	}
+
+	emptyJSON := []byte(`{
+		"model": "gpt-5.2",
+		"messages": [{"role": "user", "content": "Search my docs."}],
+		"tools": [{"type": "file_search", "vector_store_ids": []}]
+	}`)
+
+	if _, err = ConvertOpenAIRequestToCodexE("gpt-5.2", emptyJSON, true); err == nil {
+		t.Fatal("Expected error for empty vector_store_ids, got nil")
+	} else if !strings.Contains(err.Error(), "vector_store_id") {
+		t.Errorf("Expected error to mention vector_store_id, got: %v", err)
+	}
+
+	lenient := ConvertOpenAIRequestToCodex("gpt-5.2", emptyJSON, true)
+	if tools := gjson.GetBytes(lenient, "tools"); len(tools.Array()) != 0 {
+		t.Errorf("Expected invalid file_search tool to be dropped in lenient mode, got %s", tools.Raw)
+	}
+}
+
+// TestConvertOpenAIRequestToCodex_AudioOutputConfig tests that audio voice and format are carried
+// over for audio-capable models and dropped otherwise
+func TestConvertOpenAIRequestToCodex_AudioOutputConfig(t *testing.T) {
+	inputJSON := []byte(`{
+		"model": "gpt-audio",
+		"messages": [{"role": "user", "content": "Say hello."}],
+		"audio": {"voice": "alloy", "format": "pcm16"}
+	}`)
+
+	output := ConvertOpenAIRequestToCodex("gpt-audio", inputJSON, true)
+	if got := gjson.GetBytes(output, "audio.voice").String(); got != "alloy" {
+		t.Errorf("Expected audio.voice 'alloy', got %q", got)
+	}
+	if got := gjson.GetBytes(output, "audio.format").String(); got != "pcm16" {
+		t.Errorf("Expected audio.format 'pcm16', got %q", got)
+	}
+
+	output = ConvertOpenAIRequestToCodex("gpt-5.2", inputJSON, true)
+	if gjson.GetBytes(output, "audio").Exists() {
+		t.Errorf("Expected audio config to be dropped for a text-only model, got %s", gjson.GetBytes(output, "audio").Raw)
+	}
+}
+
+// TestConvertOpenAIRequestToCodex_TextOnlyModalitiesStripped tests that modalities ["text"] is
+// stripped cleanly while audio modalities are handled separately
+func TestConvertOpenAIRequestToCodex_TextOnlyModalitiesStripped(t *testing.T) {
+	textOnly := []byte(`{
+		"model": "gpt-5.2",
+		"messages": [{"role": "user", "content": "Hello"}],
+		"modalities": ["text"]
+	}`)
+
+	output, err := ConvertOpenAIRequestToCodexE("gpt-5.2", textOnly, true)
+	if err != nil {
+		t.Fatalf("Unexpected error for text-only modalities: %v", err)
+	}
+	if gjson.GetBytes(output, "modalities").Exists() {
+		t.Errorf("Expected text-only modalities to be stripped, got %s", gjson.GetBytes(output, "modalities").Raw)
+	}
+
+	withAudio := []byte(`{
+		"model": "gpt-5.2",
+		"messages": [{"role": "user", "content": "Hello"}],
+		"modalities": ["text", "audio"]
+	}`)
+	if _, err = ConvertOpenAIRequestToCodexE("gpt-5.2", withAudio, true); err == nil {
+		t.Error("Expected error for audio modalities on a text-only model")
+	}
+
+	output, err = ConvertOpenAIRequestToCodexE("gpt-audio", withAudio, true)
+	if err != nil {
+		t.Fatalf("Unexpected error for audio-capable model: %v", err)
+	}
+	if got := gjson.GetBytes(output, "modalities").Raw; got != `["text", "audio"]` {
+		t.Errorf("Expected audio modalities to be forwarded, got %s", got)
+	}
+}
+
+// TestConvertOpenAIRequestToCodex_LegacyFunctionsParallelToolCalls tests that legacy functions
+// requests disable parallel tool calls while tools requests keep them enabled
+func TestConvertOpenAIRequestToCodex_LegacyFunctionsParallelToolCalls(t *testing.T) {
+	legacyJSON := []byte(`{
+		"model": "gpt-5.2",
+		"messages": [{"role": "user", "content": "Weather in Paris?"}],
+		"functions": [{"name": "get_weather", "parameters": {"type": "object", "properties": {"city": {"type": "string"}}}}],
+		"function_call": {"name": "get_weather"}
+	}`)
+
+	output := ConvertOpenAIRequestToCodex("gpt-5.2", legacyJSON, true)
+
+	if v := gjson.GetBytes(output, "parallel_tool_calls"); v.Type != gjson.False {
+		t.Errorf("Expected parallel_tool_calls false for a legacy request, got %s", v.Raw)
+	}
+	if got := gjson.GetBytes(output, "tools.0.name").String(); got != "get_weather" {
+		t.Errorf("Expected legacy function to be mapped to a tool, got %s", gjson.GetBytes(output, "tools").Raw)
+	}
+	if got := gjson.GetBytes(output, "tool_choice.name").String(); got != "get_weather" {
+		t.Errorf("Expected legacy function_call to be mapped to tool_choice, got %s", gjson.GetBytes(output, "tool_choice").Raw)
+	}
+
+	toolsJSON := []byte(`{
+		"model": "gpt-5.2",
+		"messages": [{"role": "user", "content": "Weather in Paris?"}],
+		"tools": [{"type": "function", "function": {"name": "get_weather"}}]
+	}`)
+	output = ConvertOpenAIRequestToCodex("gpt-5.2", toolsJSON, true)
+	if v := gjson.GetBytes(output, "parallel_tool_calls"); v.Type != gjson.True {
+		t.Errorf("Expected parallel_tool_calls true for a tools request, got %s", v.Raw)
+	}
+}
+
+// TestConvertOpenAIRequestToCodex_ArgumentsStringOrObject tests that stringified arguments pass
+// through unchanged and object arguments are marshaled to a string
+func TestConvertOpenAIRequestToCodex_ArgumentsStringOrObject(t *testing.T) {
+	inputJSON := []byte(`{
+		"model": "gpt-5.2",
+		"messages": [
+			{"role": "user", "content": "Look both up."},
+			{
+				"role": "assistant",
+				"content": null,
+				"tool_calls": [
+					{"id": "call_str", "type": "function", "function": {"name": "lookup", "arguments": "{\"q\": \"a \\\"quoted\\\" term\"}"}},
+					{"id": "call_obj", "type": "function", "function": {"name": "lookup", "arguments": {"q": "b", "filters": {"lang": "en"}}}}
+				]
+			}
+		]
+	}`)
+
+	output := ConvertOpenAIRequestToCodex("gpt-5.2", inputJSON, true)
+
+	strArgs := gjson.GetBytes(output, "input.2.arguments")
+	if strArgs.Type != gjson.String || strArgs.String() != `{"q": "a \"quoted\" term"}` {
+		t.Errorf("Expected string arguments to pass through unchanged, got %s", strArgs.Raw)
+	}
+
+	objArgs := gjson.GetBytes(output, "input.3.arguments")
+	if objArgs.Type != gjson.String {
+		t.Fatalf("Expected object arguments to be marshaled to a string, got %s", objArgs.Raw)
+	}
+	if objArgs.String() != `{"q":"b","filters":{"lang":"en"}}` {
+		t.Errorf("Expected compact JSON string arguments, got %q", objArgs.String())
+	}
+}
+
+// FuzzConvertOpenAIRequestToCodex feeds arbitrary bytes to the translator and checks that it never
+// panics and that the strict variant either rejects the input or produces valid JSON
+func FuzzConvertOpenAIRequestToCodex(f *testing.F) {
+	f.Add([]byte(`{"model":"gpt-5.2","messages":[{"role":"user","content":"hi"}]}`))
+	f.Add([]byte(`{"messages":[{"role":"assistant","content":[{"type":"tool_call","id":"c","function":{"name":"f","arguments":{}}}]},{"role":"tool","tool_call_id":"c","content":"x"}]}`))
+	f.Add([]byte(`{"messages":[{"role":"user","content":[{"type":"image_url","image_url":"https://x"},{"type":"input_image","image_url":{"url":"y"}}]}],"tools":[{"type":"code_interpreter"},{"type":"function","function":{"name":"n"}}],"tool_choice":{"type":"function","function":{"name":"n"}}}`))
+	f.Add([]byte(`{"functions":[{"name":"f"}],"function_call":"auto","response_format":{"type":"json_schema","json_schema":{"schema":{}}}}`))
+	f.Add([]byte(`{"messages":"hello"}`))
+	f.Add([]byte(`[1,2`))
+	f.Add([]byte(``))
+
+	f.Fuzz(func(t *testing.T, data []byte) {
+		_ = ConvertOpenAIRequestToCodex("gpt-5.2", data, true)
+		for _, opts := range []Options{{}, {SplitImagesToSeparateMessages: true, ParseInlineToolCalls: true, GroupFunctionCalls: true}} {
+			out, err := ConvertOpenAIRequestToCodexWithOptions("gpt-5.2", data, true, opts)
+			if err == nil && !gjson.ValidBytes(out) {
+				t.Fatalf("Expected valid JSON output for input %q, got %q", data, out)
+			}
+		}
+	})
+}
+
+// TestConvertOpenAIRequestToCodex_CorrelationID tests that a configured correlation id is stored
+// in metadata and that metadata is untouched otherwise
+func TestConvertOpenAIRequestToCodex_CorrelationID(t *testing.T) {
+	inputJSON := []byte(`{"model": "gpt-5.2", "messages": [{"role": "user", "content": "Hello"}]}`)
+
+	output, err := ConvertOpenAIRequestToCodexWithOptions("gpt-5.2", inputJSON, true, Options{CorrelationID: "req-42"})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if got := gjson.GetBytes(output, "metadata.correlation_id").String(); got != "req-42" {
+		t.Errorf("Expected metadata.correlation_id 'req-42', got %q", got)
+	}
+
+	output = ConvertOpenAIRequestToCodex("gpt-5.2", inputJSON, true)
+	if gjson.GetBytes(output, "metadata").Exists() {
+		t.Errorf("Expected no metadata without a correlation id, got %s", gjson.GetBytes(output, "metadata").Raw)
+	}
+}
+
+// TestConvertOpenAIRequestToCodex_TrimTextParts tests that a BOM-prefixed, padded text part is
+// cleaned when the option is enabled
+func TestConvertOpenAIRequestToCodex_TrimTextParts(t *testing.T) {
+	inputJSON := []byte("{\"model\": \"gpt-5.2\", \"messages\": [{\"role\": \"user\", \"content\": [{\"type\": \"text\", \"text\": \"\xef\xbb\xbf  Hello there \\n\"}]}]}")
+
+	output, err := ConvertOpenAIRequestToCodexWithOptions("gpt-5.2", inputJSON, true, Options{TrimTextParts: true})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if got := gjson.GetBytes(output, "input.0.content.0.text").String(); got != "Hello there" {
+		t.Errorf("Expected cleaned text 'Hello there', got %q", got)
+	}
+
+	output = ConvertOpenAIRequestToCodex("gpt-5.2", inputJSON, true)
+	if got := gjson.GetBytes(output, "input.0.content.0.text").String(); !strings.HasPrefix(got, "\uFEFF") {
+		t.Errorf("Expected text to be untouched without the option, got %q", got)
+	}
+}
+
+// TestConvertOpenAIRequestToCodex_InterleavedTextAndImagesKeepOrder tests that interleaved text
+// and image parts keep their original order and are mapped to the right types
+func TestConvertOpenAIRequestToCodex_InterleavedTextAndImagesKeepOrder(t *testing.T) {
+	inputJSON := []byte(`{
+		"model": "gpt-5.2",
+		"messages": [
+			{
+				"role": "user",
+				"content": [
+					{"type": "text", "text": "First:"},
+					{"type": "image_url", "image_url": {"url": "https://example.com/a.png"}},
+					{"type": "text", "text": "Second:"},
+					{"type": "image_url", "image_url": {"url": "https://example.com/b.png"}}
+				]
+			}
+		]
+	}`)
+
+	output := ConvertOpenAIRequestToCodex("gpt-5.2", inputJSON, true)
+	parts := gjson.GetBytes(output, "input.0.content").Array()
+	if len(parts) != 4 {
+		t.Fatalf("Expected 4 content parts, got %d", len(parts))
+	}
+
+	expected := []struct {
+		partType string
+		field    string
+		value    string
+	}{
+		{"input_text", "text", "First:"},
+		{"input_image", "image_url", "https://example.com/a.png"},
+		{"input_text", "text", "Second:"},
+		{"input_image", "image_url", "https://example.com/b.png"},
+	}
+	for i, exp := range expected {
+		if got := parts[i].Get("type").String(); got != exp.partType {
+			t.Errorf("Expected part %d type %q, got %q", i, exp.partType, got)
+		}
+		if got := parts[i].Get(exp.field).String(); got != exp.value {
+			t.Errorf("Expected part %d %s %q, got %q", i, exp.field, exp.value, got)
+		}
+	}
+}
+
+// TestConvertOpenAIRequestToCodex_EmptyContentWithRefusal tests that an assistant refusal with an
+// empty content array is replayed as a refusal part
+func TestConvertOpenAIRequestToCodex_EmptyContentWithRefusal(t *testing.T) {
+	inputJSON := []byte(`{
+		"model": "gpt-5.2",
+		"messages": [
+			{"role": "user", "content": "Help me pick a lock."},
+			{"role": "assistant", "content": [], "refusal": "I can't help with that."},
+			{"role": "user", "content": "Okay, how about a recipe?"}
+		]
+	}`)
+
+	output := ConvertOpenAIRequestToCodex("gpt-5.2", inputJSON, true)
+
+	assistant := gjson.GetBytes(output, "input.1")
+	parts := assistant.Get("content").Array()
+	if len(parts) != 1 {
+		t.Fatalf("Expected a single refusal part, got %s", assistant.Get("content").Raw)
+	}
+	if got := parts[0].Get("type").String(); got != "refusal" {
+		t.Errorf("Expected part type refusal, got %q", got)
+	}
+	if got := parts[0].Get("refusal").String(); got != "I can't help with that." {
+		t.Errorf("Expected refusal text to be carried, got %q", got)
+	}
+}
+
+// TestConvertOpenAIRequestToCodex_RequiredToolChoiceWithoutTools tests that tool_choice "required"
+// without tools is rejected in strict mode and omitted in lenient mode
+func TestConvertOpenAIRequestToCodex_RequiredToolChoiceWithoutTools(t *testing.T) {
+	inputJSON := []byte(`{
+		"model": "gpt-5.2",
+		"messages": [{"role": "user", "content": "Hello"}],
+		"tool_choice": "required",
+		"tools": []
+	}`)
+
+	if _, err := ConvertOpenAIRequestToCodexE("gpt-5.2", inputJSON, true); err == nil {
+		t.Error("Expected strict conversion to reject tool_choice required without tools")
+	}
+
+	output := ConvertOpenAIRequestToCodex("gpt-5.2", inputJSON, true)
+	if gjson.GetBytes(output, "tool_choice").Exists() {
+		t.Errorf("Expected lenient conversion to omit tool_choice, got %s", gjson.GetBytes(output, "tool_choice").Raw)
+	}
+
+	withTools := []byte(`{
+		"model": "gpt-5.2",
+		"messages": [{"role": "user", "content": "Hello"}],
+		"tool_choice": "required",
+		"tools": [{"type": "function", "function": {"name": "greet"}}]
+	}`)
+	output, err := ConvertOpenAIRequestToCodexE("gpt-5.2", withTools, true)
+	if err != nil {
+		t.Fatalf("Unexpected error with tools present: %v", err)
+	}
+	if got := gjson.GetBytes(output, "tool_choice").String(); got != "required" {
+		t.Errorf("Expected tool_choice required to be kept, got %q", got)
+	}
+}
+
+// TestConvertOpenAIRequestToCodex_LegacyFunctionRole tests that a legacy function-role message is
+// converted into a function_call_output and that message names are dropped
+func TestConvertOpenAIRequestToCodex_LegacyFunctionRole(t *testing.T) {
+	inputJSON := []byte(`{
+		"model": "gpt-5.2",
+		"messages": [
+			{"role": "user", "name": "alice", "content": "Weather in Paris?"},
+			{"role": "function", "name": "get_weather", "content": "{\"temp\": 21}"}
+		]
+	}`)
+
+	output := ConvertOpenAIRequestToCodex("gpt-5.2", inputJSON, true)
+
+	user := gjson.GetBytes(output, "input.0")
+	if user.Get("name").Exists() {
+		t.Errorf("Expected name to be dropped from the user message, got %s", user.Raw)
+	}
+
+	result := gjson.GetBytes(output, "input.1")
+	if got := result.Get("type").String(); got != "function_call_output" {
+		t.Fatalf("Expected function_call_output for the function role, got %s", result.Raw)
+	}
+	if got := result.Get("output").String(); got != `{"temp": 21}` {
+		t.Errorf("Expected function content as output, got %q", got)
+	}
+	if result.Get("call_id").String() == "" {
+		t.Error("Expected a call_id on the legacy function output")
+	}
+}
+
+// TestConvertOpenAIRequestToCodex_InlineSystemIntoUser tests that a system+user conversation
+// becomes a single user message with the combined text
+func TestConvertOpenAIRequestToCodex_InlineSystemIntoUser(t *testing.T) {
+	inputJSON := []byte(`{
+		"model": "gpt-5.2",
+		"messages": [
+			{"role": "system", "content": "You are a pirate."},
+			{"role": "user", "content": "Say hello."}
+		]
+	}`)
+
+	output, err := ConvertOpenAIRequestToCodexWithOptions("gpt-5.2", inputJSON, true, Options{InlineSystemIntoUser: true})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	input := gjson.GetBytes(output, "input").Array()
+	if len(input) != 1 {
+		t.Fatalf("Expected a single message, got %d: %s", len(input), gjson.GetBytes(output, "input").Raw)
+	}
+	if got := input[0].Get("role").String(); got != "user" {
+		t.Errorf("Expected user role, got %q", got)
+	}
+	if got := input[0].Get("content.0.text").String(); got != "You are a pirate.\n\nSay hello." {
+		t.Errorf("Expected combined text, got %q", got)
+	}
+}
+
+// TestConvertOpenAIRequestToCodex_LegacyAssistantFunctionCall tests that a legacy assistant
+// function_call is emitted as a function_call item paired with the function-role result
+func TestConvertOpenAIRequestToCodex_LegacyAssistantFunctionCall(t *testing.T) {
+	inputJSON := []byte(`{
+		"model": "gpt-5.2",
+		"messages": [
+			{"role": "user", "content": "Weather in Paris?"},
+			{"role": "assistant", "content": null, "function_call": {"name": "get_weather", "arguments": "{\"city\":\"Paris\"}"}},
+			{"role": "function", "name": "get_weather", "content": "sunny"}
+		]
+	}`)
+
+	output := ConvertOpenAIRequestToCodex("gpt-5.2", inputJSON, true)
+
+	call := gjson.GetBytes(output, `input.#(type=="function_call")`)
+	if !call.Exists() {
+		t.Fatalf("Expected a function_call item, got %s", gjson.GetBytes(output, "input").Raw)
+	}
+	if got := call.Get("name").String(); got != "get_weather" {
+		t.Errorf("Expected name get_weather, got %q", got)
+	}
+	if got := call.Get("arguments").String(); got != `{"city":"Paris"}` {
+		t.Errorf("Expected arguments to be carried, got %q", got)
+	}
+	callID := call.Get("call_id").String()
+	if callID == "" {
+		t.Fatal("Expected a synthesized call_id")
+	}
+
+	result := gjson.GetBytes(output, `input.#(type=="function_call_output")`)
+	if got := result.Get("call_id").String(); got != callID {
+		t.Errorf("Expected function result call_id %q to match the call, got %q", callID, got)
+	}
+}
+
+// TestConvertOpenAIRequestToCodex_StringifiedJSONSchema tests that a double-encoded schema is
+// decoded and embedded as a JSON object
+func TestConvertOpenAIRequestToCodex_StringifiedJSONSchema(t *testing.T) {
+	inputJSON := []byte(`{
+		"model": "gpt-5.2",
+		"messages": [{"role": "user", "content": "Give me a person."}],
+		"response_format": {
+			"type": "json_schema",
+			"json_schema": {
+				"name": "person",
+				"strict": true,
+				"schema": "{\"type\":\"object\",\"properties\":{\"name\":{\"type\":\"string\"}},\"required\":[\"name\"]}"
+			}
+		}
+	}`)
+
+	output := ConvertOpenAIRequestToCodex("gpt-5.2", inputJSON, true)
+
+	schema := gjson.GetBytes(output, "text.format.schema")
+	if !schema.IsObject() {
+		t.Fatalf("Expected schema to be embedded as an object, got %s", schema.Raw)
+	}
+	if got := schema.Get("properties.name.type").String(); got != "string" {
+		t.Errorf("Expected properties.name.type string, got %q", got)
+	}
+	if got := gjson.GetBytes(output, "text.format.name").String(); got != "person" {
+		t.Errorf("Expected format name person, got %q", got)
+	}
+}
+
+// TestConvertOpenAIRequestToCodex_SyntheticCallIDForMissingID tests that a tool call without an id
+// gets a stable synthetic call_id that the matching tool result reuses
+func TestConvertOpenAIRequestToCodex_SyntheticCallIDForMissingID(t *testing.T) {
+	inputJSON := []byte(`{
+		"model": "gpt-5.2",
+		"messages": [
+			{"role": "user", "content": "Weather in Paris?"},
+			{"role": "assistant", "content": null, "tool_calls": [{"type": "function", "function": {"name": "get_weather", "arguments": "{\"city\":\"Paris\"}"}}]},
+			{"role": "tool", "content": "sunny"}
+		]
+	}`)
+
+	output := ConvertOpenAIRequestToCodex("gpt-5.2", inputJSON, true)
+
+	callID := gjson.GetBytes(output, `input.#(type=="function_call").call_id`).String()
+	if callID == "" {
+		t.Fatal("Expected a synthetic call_id for the tool call")
+	}
+	if got := gjson.GetBytes(output, `input.#(type=="function_call_output").call_id`).String(); got != callID {
+		t.Errorf("Expected tool result call_id %q to match, got %q", callID, got)
+	}
+
+	again := ConvertOpenAIRequestToCodex("gpt-5.2", inputJSON, true)
+	if got := gjson.GetBytes(again, `input.#(type=="function_call").call_id`).String(); got != callID {
+		t.Errorf("Expected synthetic call_id to be stable, got %q then %q", callID, got)
+	}
+}
+
+// countdownContext reports cancellation after Err has been consulted a fixed number of times,
+// simulating a caller that gives up partway through a conversion.
+type countdownContext struct {
+	context.Context
+	remaining int
+}
+
+func (c *countdownContext) Err() error {
+	if c.remaining <= 0 {
+		return context.Canceled
+	}
+	c.remaining--
+	return nil
+}
+
+// TestConvertOpenAIRequestToCodexCtx_CancelMidConversion tests that cancellation during a large
+// conversion stops it early with the context error
+func TestConvertOpenAIRequestToCodexCtx_CancelMidConversion(t *testing.T) {
+	var sb strings.Builder
+	sb.WriteString(`{"model":"gpt-5.2","messages":[`)
+	for i := 0; i < 1000; i++ {
+		if i > 0 {
+			sb.WriteString(",")
+		}
+		fmt.Fprintf(&sb, `{"role":"user","content":"message %d"}`, i)
+	}
+	sb.WriteString(`]}`)
+	inputJSON := []byte(sb.String())
+
+	ctx := &countdownContext{Context: context.Background(), remaining: 3}
+	output, err := ConvertOpenAIRequestToCodexCtx(ctx, "gpt-5.2", inputJSON, true)
+	if !errors.Is(err, context.Canceled) {
+		t.Fatalf("Expected context.Canceled, got %v", err)
+	}
+	if output != nil {
+		t.Errorf("Expected no output after cancellation, got %d bytes", len(output))
+	}
+	if ctx.remaining != 0 {
+		t.Errorf("Expected the conversion to stop at the first failed check, %d checks left", ctx.remaining)
+	}
+
+	output, err = ConvertOpenAIRequestToCodexCtx(context.Background(), "gpt-5.2", inputJSON, true)
+	if err != nil {
+		t.Fatalf("Unexpected error without cancellation: %v", err)
+	}
+	if n := len(gjson.GetBytes(output, "input").Array()); n != 1000 {
+		t.Errorf("Expected 1000 input items, got %d", n)
+	}
+}
+
+// TestConvertOpenAIRequestToCodex_ImageURLSchemes tests that only http, https and data image URLs
+// are forwarded and that the strict variant rejects other schemes
+func TestConvertOpenAIRequestToCodex_ImageURLSchemes(t *testing.T) {
+	inputJSON := []byte(`{
+		"model": "gpt-5.2",
+		"messages": [
+			{"role": "user", "content": [
+				{"type": "text", "text": "Compare these"},
+				{"type": "image_url", "image_url": {"url": "file:///home/user/cat.png"}},
+				{"type": "image_url", "image_url": {"url": "https://example.com/dog.png"}}
+			]}
+		]
+	}`)
+
+	output := ConvertOpenAIRequestToCodex("gpt-5.2", inputJSON, false)
+	content := gjson.GetBytes(output, "input.0.content").Array()
+	if len(content) != 2 {
+		t.Fatalf("Expected the file:// image to be dropped leaving 2 parts, got %d: %s", len(content), gjson.GetBytes(output, "input.0.content").Raw)
+	}
+	if got := content[1].Get("image_url").String(); got != "https://example.com/dog.png" {
+		t.Errorf("Expected the https image to be forwarded, got %q", got)
+	}
+
+	if _, err := ConvertOpenAIRequestToCodexE("gpt-5.2", inputJSON, false); err == nil || !strings.Contains(err.Error(), "scheme") {
+		t.Errorf("Expected strict conversion to reject the file:// URL, got %v", err)
+	}
+
+	validJSON := []byte(`{"model":"gpt-5.2","messages":[{"role":"user","content":[{"type":"image_url","image_url":{"url":"https://example.com/dog.png"}}]}]}`)
+	if _, err := ConvertOpenAIRequestToCodexE("gpt-5.2", validJSON, false); err != nil {
+		t.Errorf("Expected https image URL to be accepted, got %v", err)
+	}
+}
+
+// TestConvertOpenAIRequestToCodex_ToolOutputSummarizer tests that oversized tool outputs are
+// replaced by the summarizer result, and truncated when no summarizer is configured
+func TestConvertOpenAIRequestToCodex_ToolOutputSummarizer(t *testing.T) {
+	longOutput := strings.Repeat("line of build log\n", 100)
+	inputJSON := []byte(`{
+		"model": "gpt-5.2",
+		"messages": [
+			{"role": "user", "content": "Run the build"},
+			{"role": "assistant", "tool_calls": [{"id": "call_1", "type": "function", "function": {"name": "build", "arguments": "{}"}}]},
+			{"role": "tool", "tool_call_id": "call_1", "content": ` + fmt.Sprintf("%q", longOutput) + `},
+			{"role": "tool", "tool_call_id": "call_2", "content": "ok"}
+		]
+	}`)
+
+	const outputsPath = `input.#(type=="function_call_output")#.output`
+	var summarized []string
+	opts := Options{
+		MaxToolOutputBytes: 256,
+		ToolOutputSummarizer: func(output string) string {
+			summarized = append(summarized, output)
+			return "build log: 100 lines"
+		},
+	}
+	output, err := ConvertOpenAIRequestToCodexWithOptions("gpt-5.2", inputJSON, false, opts)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if got := gjson.GetBytes(output, outputsPath+"|0").String(); got != "build log: 100 lines" {
+		t.Errorf("Expected summarized tool output, got %q", got)
+	}
+	if got := gjson.GetBytes(output, outputsPath+"|1").String(); got != "ok" {
+		t.Errorf("Expected small tool output to be kept, got %q", got)
+	}
+	if len(summarized) != 1 || summarized[0] != longOutput {
+		t.Errorf("Expected the summarizer to be called once with the full output, got %d calls", len(summarized))
+	}
+
+	output, err = ConvertOpenAIRequestToCodexWithOptions("gpt-5.2", inputJSON, false, Options{MaxToolOutputBytes: 256})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if got := gjson.GetBytes(output, outputsPath+"|0").String(); got != longOutput[:256] {
+		t.Errorf("Expected tool output truncated to 256 bytes, got %d bytes", len(got))
+	}
+
+	output = ConvertOpenAIRequestToCodex("gpt-5.2", inputJSON, false)
+	if got := gjson.GetBytes(output, outputsPath+"|0").String(); got != longOutput {
+		t.Errorf("Expected tool output unchanged without a limit, got %d bytes", len(got))
+	}
+}
+
+// TestConvertOpenAIRequestToCodex_MaxToolCalls tests that max_tool_calls is forwarded only for
+// models that honor a tool call budget
+func TestConvertOpenAIRequestToCodex_MaxToolCalls(t *testing.T) {
+	inputJSON := []byte(`{"model":"gpt-5.2","messages":[{"role":"user","content":"Hello"}],"max_tool_calls":3}`)
+
+	output := ConvertOpenAIRequestToCodex("gpt-5.2", inputJSON, false)
+	if got := gjson.GetBytes(output, "max_tool_calls"); got.Int() != 3 {
+		t.Errorf("Expected max_tool_calls 3, got %s", got.Raw)
+	}
+
+	output = ConvertOpenAIRequestToCodex("gpt-audio", inputJSON, false)
+	if gjson.GetBytes(output, "max_tool_calls").Exists() {
+		t.Error("Expected max_tool_calls to be dropped for a model without support")
+	}
+}
+
+// TestConvertOpenAIRequestToCodex_TruncationOption tests that the Truncation option sets the
+// Codex truncation strategy and is absent by default
+func TestConvertOpenAIRequestToCodex_TruncationOption(t *testing.T) {
+	inputJSON := []byte(`{"model":"gpt-5.2","messages":[{"role":"user","content":"Hello"}]}`)
+
+	if gjson.GetBytes(ConvertOpenAIRequestToCodex("gpt-5.2", inputJSON, false), "truncation").Exists() {
+		t.Error("Expected no truncation field by default")
+	}
+
+	output, err := ConvertOpenAIRequestToCodexWithOptions("gpt-5.2", inputJSON, false, Options{Truncation: "auto"})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if got := gjson.GetBytes(output, "truncation").String(); got != "auto" {
+		t.Errorf("Expected truncation 'auto', got %q", got)
+	}
+
+	if _, err = ConvertOpenAIRequestToCodexWithOptions("gpt-5.2", inputJSON, false, Options{Truncation: "oldest"}); err == nil {
+		t.Error("Expected an error for an unknown truncation strategy")
+	}
+}
+
+// TestConvertOpenAIRequestToCodex_MixedCasePartTypes tests that content part types are matched
+// case-insensitively
+func TestConvertOpenAIRequestToCodex_MixedCasePartTypes(t *testing.T) {
+	inputJSON := []byte(`{
+		"model": "gpt-5.2",
+		"messages": [
+			{"role": "user", "content": [
+				{"type": "Text", "text": "What is this?"},
+				{"type": "IMAGE_URL", "image_url": {"url": "https://example.com/cat.png"}}
+			]}
+		]
+	}`)
+
+	output := ConvertOpenAIRequestToCodex("gpt-5.2", inputJSON, false)
+
+	content := gjson.GetBytes(output, "input.0.content").Array()
+	if len(content) != 2 {
+		t.Fatalf("Expected 2 content parts, got %d: %s", len(content), gjson.GetBytes(output, "input.0.content").Raw)
+	}
+	if got := content[0].Get("type").String(); got != "input_text" {
+		t.Errorf("Expected first part type 'input_text', got %q", got)
+	}
+	if got := content[0].Get("text").String(); got != "What is this?" {
+		t.Errorf("Expected text to be preserved, got %q", got)
+	}
+	if got := content[1].Get("type").String(); got != "input_image" {
+		t.Errorf("Expected second part type 'input_image', got %q", got)
+	}
+	if got := content[1].Get("image_url").String(); got != "https://example.com/cat.png" {
+		t.Errorf("Expected image URL to be preserved, got %q", got)
+	}
+}
+
+// TestConvertOpenAIRequestToCodex_ToolResultWithImage tests that a tool result carrying an image
+// is forwarded as structured output instead of a string
+func TestConvertOpenAIRequestToCodex_ToolResultWithImage(t *testing.T) {
+	inputJSON := []byte(`{
+		"model": "gpt-5.2",
+		"messages": [
+			{"role": "user", "content": "Take a screenshot"},
+			{"role": "assistant", "tool_calls": [{"id": "call_1", "type": "function", "function": {"name": "screenshot", "arguments": "{}"}}]},
+			{"role": "tool", "tool_call_id": "call_1", "content": [
+				{"type": "text", "text": "Screenshot of the login page"},
+				{"type": "image_url", "image_url": {"url": "data:image/png;base64,iVBORw0KGgo=", "detail": "high"}}
+			]}
+		]
+	}`)
+
+	output := ConvertOpenAIRequestToCodex("gpt-5.2", inputJSON, false)
+
+	result := gjson.GetBytes(output, `input.#(type=="function_call_output")`)
+	if got := result.Get("call_id").String(); got != "call_1" {
+		t.Fatalf("Expected function_call_output for call_1, got %s", result.Raw)
+	}
+	parts := result.Get("output").Array()
+	if len(parts) != 2 {
+		t.Fatalf("Expected structured output with 2 items, got %s", result.Get("output").Raw)
+	}
+	if got := parts[0].Get("type").String(); got != "input_text" {
+		t.Errorf("Expected first item type 'input_text', got %q", got)
+	}
+	if got := parts[0].Get("text").String(); got != "Screenshot of the login page" {
+		t.Errorf("Expected text to be preserved, got %q", got)
+	}
+	if got := parts[1].Get("type").String(); got != "input_image" {
+		t.Errorf("Expected second item type 'input_image', got %q", got)
+	}
+	if got := parts[1].Get("image_url").String(); got != "data:image/png;base64,iVBORw0KGgo=" {
+		t.Errorf("Expected image URL to be preserved, got %q", got)
+	}
+	if got := parts[1].Get("detail").String(); got != "high" {
+		t.Errorf("Expected detail 'high', got %q", got)
+	}
+}
+
+// TestConvertOpenAIRequestToCodex_MetadataReasoningEffort tests that metadata.reasoning_effort is
+// used only when enabled and the top-level field is absent
+func TestConvertOpenAIRequestToCodex_MetadataReasoningEffort(t *testing.T) {
+	inputJSON := []byte(`{"model":"gpt-5.2","messages":[{"role":"user","content":"Hello"}],"metadata":{"reasoning_effort":"high"}}`)
+	opts := Options{MetadataReasoningEffort: true}
+
+	output, err := ConvertOpenAIRequestToCodexWithOptions("gpt-5.2", inputJSON, false, opts)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if got := gjson.GetBytes(output, "reasoning.effort").String(); got != "high" {
+		t.Errorf("Expected reasoning effort 'high' from metadata, got %q", got)
+	}
+
+	if got := gjson.GetBytes(ConvertOpenAIRequestToCodex("gpt-5.2", inputJSON, false), "reasoning.effort").String(); got != "medium" {
+		t.Errorf("Expected metadata to be ignored by default, got %q", got)
+	}
+
+	topLevel := []byte(`{"model":"gpt-5.2","messages":[{"role":"user","content":"Hello"}],"reasoning_effort":"low","metadata":{"reasoning_effort":"high"}}`)
+	output, _ = ConvertOpenAIRequestToCodexWithOptions("gpt-5.2", topLevel, false, opts)
+	if got := gjson.GetBytes(output, "reasoning.effort").String(); got != "low" {
+		t.Errorf("Expected top-level reasoning_effort to win, got %q", got)
+	}
+}
+
+// TestConvertOpenAIRequestToCodex_ModelNameNormalization tests that provider prefixes and aliases
+// are rewritten only when configured
+func TestConvertOpenAIRequestToCodex_ModelNameNormalization(t *testing.T) {
+	inputJSON := []byte(`{"messages":[{"role":"user","content":"Hello"}]}`)
+	opts := Options{ModelName: common.ModelNameNormalization{
+		StripProviderPrefix: true,
+		Aliases:             map[string]string{"gpt-latest": "gpt-5.2"},
+	}}
+
+	output, err := ConvertOpenAIRequestToCodexWithOptions("openai/gpt-latest", inputJSON, false, opts)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if got := gjson.GetBytes(output, "model").String(); got != "gpt-5.2" {
+		t.Errorf("Expected prefixed alias to map to 'gpt-5.2', got %q", got)
+	}
+
+	output, _ = ConvertOpenAIRequestToCodexWithOptions("gpt-5.2-codex", inputJSON, false, opts)
+	if got := gjson.GetBytes(output, "model").String(); got != "gpt-5.2-codex" {
+		t.Errorf("Expected direct name to be kept, got %q", got)
+	}
+
+	output = ConvertOpenAIRequestToCodex("openai/gpt-latest", inputJSON, false)
+	if got := gjson.GetBytes(output, "model").String(); got != "openai/gpt-latest" {
+		t.Errorf("Expected model to be verbatim by default, got %q", got)
+	}
+}
+
+// TestConvertOpenAIRequestToCodex_DefaultInstructions tests that DefaultInstructions is injected
+// only when the request has no system or developer message
+func TestConvertOpenAIRequestToCodex_DefaultInstructions(t *testing.T) {
+	opts := Options{DefaultInstructions: "You are a coding assistant."}
+
+	inputJSON := []byte(`{"model":"gpt-5.2","messages":[{"role":"user","content":"Hello"}]}`)
+	output, err := ConvertOpenAIRequestToCodexWithOptions("gpt-5.2", inputJSON, false, opts)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	input := gjson.GetBytes(output, "input").Array()
+	if len(input) != 2 {
+		t.Fatalf("Expected 2 input items, got %d", len(input))
+	}
+	if got := input[0].Get("role").String(); got != "developer" {
+		t.Errorf("Expected injected developer message first, got role %q", got)
+	}
+	if got := input[0].Get("content.0.text").String(); got != "You are a coding assistant." {
+		t.Errorf("Expected default instructions text, got %q", got)
+	}
+	if got := input[1].Get("content.0.text").String(); got != "Hello" {
+		t.Errorf("Expected user message to follow, got %q", got)
+	}
+
+	withSystem := []byte(`{"model":"gpt-5.2","messages":[{"role":"system","content":"Be brief."},{"role":"user","content":"Hello"}]}`)
+	output, _ = ConvertOpenAIRequestToCodexWithOptions("gpt-5.2", withSystem, false, opts)
+	input = gjson.GetBytes(output, "input").Array()
+	if len(input) != 2 {
+		t.Fatalf("Expected no injection when a system message exists, got %d items", len(input))
+	}
+	if got := input[0].Get("content.0.text").String(); got != "Be brief." {
+		t.Errorf("Expected the client's system message to be kept, got %q", got)
+	}
+}
+
+// TestConvertOpenAIRequestToCodex_Logprobs tests that logprobs adds the logprobs include entry
+// alongside the forced one and forwards top_logprobs
+func TestConvertOpenAIRequestToCodex_Logprobs(t *testing.T) {
+	inputJSON := []byte(`{"model":"gpt-5.2","messages":[{"role":"user","content":"Hello"}],"logprobs":true,"top_logprobs":5}`)
+
+	output := ConvertOpenAIRequestToCodex("gpt-5.2", inputJSON, false)
+
+	if got := gjson.GetBytes(output, "include").Raw; got != `["reasoning.encrypted_content","message.output_text.logprobs"]` {
+		t.Errorf("Expected logprobs include entry merged with the forced entry, got %s", got)
+	}
+	if got := gjson.GetBytes(output, "top_logprobs"); got.Int() != 5 {
+		t.Errorf("Expected top_logprobs 5, got %s", got.Raw)
+	}
+
+	plain := []byte(`{"model":"gpt-5.2","messages":[{"role":"user","content":"Hello"}],"top_logprobs":5}`)
+	output = ConvertOpenAIRequestToCodex("gpt-5.2", plain, false)
+	if got := gjson.GetBytes(output, "include").Raw; got != `["reasoning.encrypted_content"]` {
+		t.Errorf("Expected only the forced include entry without logprobs, got %s", got)
+	}
+	if gjson.GetBytes(output, "top_logprobs").Exists() {
+		t.Error("Expected top_logprobs to be dropped without logprobs")
+	}
+}
+
+// TestConvertOpenAIRequestToCodex_CodexCompatFields tests that the compatibility fields are added
+// when enabled without overriding client values
+func TestConvertOpenAIRequestToCodex_CodexCompatFields(t *testing.T) {
+	inputJSON := []byte(`{"model":"gpt-5.2","messages":[{"role":"user","content":"Hello"}]}`)
+
+	output := ConvertOpenAIRequestToCodex("gpt-5.2", inputJSON, false)
+	if gjson.GetBytes(output, "tools").Exists() || gjson.GetBytes(output, "tool_choice").Exists() {
+		t.Errorf("Expected no compatibility fields by default, got %s", output)
+	}
+
+	opts := Options{CodexCompatFields: true}
+	output, err := ConvertOpenAIRequestToCodexWithOptions("gpt-5.2", inputJSON, false, opts)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if got := gjson.GetBytes(output, "tools").Raw; got != `[]` {
+		t.Errorf("Expected empty tools list, got %s", got)
+	}
+	if got := gjson.GetBytes(output, "tool_choice").String(); got != "auto" {
+		t.Errorf("Expected tool_choice 'auto', got %q", got)
+	}
+
+	withTools := []byte(`{"model":"gpt-5.2","messages":[{"role":"user","content":"Hello"}],"tools":[{"type":"function","function":{"name":"f","parameters":{}}}],"tool_choice":"none"}`)
+	output, _ = ConvertOpenAIRequestToCodexWithOptions("gpt-5.2", withTools, false, opts)
+	if got := len(gjson.GetBytes(output, "tools").Array()); got != 1 {
+		t.Errorf("Expected client tools to be kept, got %d", got)
+	}
+	if got := gjson.GetBytes(output, "tool_choice").String(); got != "none" {
+		t.Errorf("Expected client tool_choice to be kept, got %q", got)
+	}
+}
+
+// TestConvertOpenAIRequestToCodex_ReplayedTurnPartTypes tests that a replayed assistant turn uses
+// output_text parts while system content becomes input_text on a developer message
+func TestConvertOpenAIRequestToCodex_ReplayedTurnPartTypes(t *testing.T) {
+	inputJSON := []byte(`{
+		"model": "gpt-5.2",
+		"messages": [
+			{"role": "system", "content": [{"type": "text", "text": "Be brief."}]},
+			{"role": "user", "content": "Hi"},
+			{"role": "assistant", "content": [{"type": "text", "text": "Hello!"}, {"type": "text", "text": "How can I help?"}]},
+			{"role": "assistant", "content": "Anything else?"}
+		]
+	}`)
+
+	output := ConvertOpenAIRequestToCodex("gpt-5.2", inputJSON, false)
+
+	checks := map[string]string{
+		"input.0.role":           "developer",
+		"input.0.content.0.type": "input_text",
+		"input.1.content.0.type": "input_text",
+		"input.2.content.0.type": "output_text",
+		"input.2.content.1.type": "output_text",
+		"input.3.content.0.type": "output_text",
+	}
+	for path, want := range checks {
+		if got := gjson.GetBytes(output, path).String(); got != want {
+			t.Errorf("Expected %s %q, got %q", path, want, got)
+		}
+	}
+}
+
+// TestConvertOpenAIRequestToCodex_PreserveCacheControl tests that caching hints on messages and
+// content parts are forwarded only when enabled
+func TestConvertOpenAIRequestToCodex_PreserveCacheControl(t *testing.T) {
+	inputJSON := []byte(`{
+		"model": "gpt-5.2",
+		"messages": [
+			{"role": "system", "content": [{"type": "text", "text": "Long reference document", "cache_control": {"type": "ephemeral"}}]},
+			{"role": "user", "content": [{"type": "text", "text": "Summarize it"}], "cache_control": {"type": "ephemeral"}}
+		]
+	}`)
+
+	output, err := ConvertOpenAIRequestToCodexWithOptions("gpt-5.2", inputJSON, false, Options{PreserveCacheControl: true})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if got := gjson.GetBytes(output, "input.0.content.0.cache_control.type").String(); got != "ephemeral" {
+		t.Errorf("Expected part cache_control to be preserved, got %s", gjson.GetBytes(output, "input.0.content.0").Raw)
+	}
+	if got := gjson.GetBytes(output, "input.1.cache_control.type").String(); got != "ephemeral" {
+		t.Errorf("Expected message cache_control to be preserved, got %s", gjson.GetBytes(output, "input.1").Raw)
+	}
+	if gjson.GetBytes(output, "input.1.content.0.cache_control").Exists() {
+		t.Error("Expected unhinted part to stay without cache_control")
+	}
+
+	output = ConvertOpenAIRequestToCodex("gpt-5.2", inputJSON, false)
+	if gjson.GetBytes(output, "input.0.content.0.cache_control").Exists() || gjson.GetBytes(output, "input.1.cache_control").Exists() {
+		t.Error("Expected caching hints to be dropped by default")
+	}
+}
+
+// TestConvertOpenAIRequestToCodex_ZeroMaxOutputTokensOmitted tests that a zero token limit is
+// omitted while a positive one is forwarded when token mapping is enabled
+func TestConvertOpenAIRequestToCodex_ZeroMaxOutputTokensOmitted(t *testing.T) {
+	opts := Options{ForwardMaxOutputTokens: true}
+
+	for _, field := range []string{"max_tokens", "max_completion_tokens"} {
+		zero := []byte(`{"model":"gpt-5.2","messages":[{"role":"user","content":"Hello"}],"` + field + `":0}`)
+		output, err := ConvertOpenAIRequestToCodexWithOptions("gpt-5.2", zero, false, opts)
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		if gjson.GetBytes(output, "max_output_tokens").Exists() {
+			t.Errorf("Expected %s of 0 to be omitted, got %s", field, gjson.GetBytes(output, "max_output_tokens").Raw)
+		}
+	}
+
+	limited := []byte(`{"model":"gpt-5.2","messages":[{"role":"user","content":"Hello"}],"max_completion_tokens":256}`)
+	output, _ := ConvertOpenAIRequestToCodexWithOptions("gpt-5.2", limited, false, opts)
+	if got := gjson.GetBytes(output, "max_output_tokens").Int(); got != 256 {
+		t.Errorf("Expected max_output_tokens 256, got %d", got)
+	}
+	if gjson.GetBytes(ConvertOpenAIRequestToCodex("gpt-5.2", limited, false), "max_output_tokens").Exists() {
+		t.Error("Expected max_output_tokens to be dropped by default")
+	}
+}
+
+// TestWriteOpenAIRequestToCodex_MatchesInMemory tests that the streamed request is byte-for-byte
+// identical to the in-memory conversion
+func TestWriteOpenAIRequestToCodex_MatchesInMemory(t *testing.T) {
+	var sb strings.Builder
+	sb.WriteString(`{"model":"gpt-5.2","messages":[{"role":"system","content":"Be brief."}`)
+	for i := 0; i < 200; i++ {
+		fmt.Fprintf(&sb, `,{"role":"user","content":[{"type":"text","text":"question %d"},{"type":"image_url","image_url":{"url":"https://example.com/%d.png"}}]}`, i, i)
+		fmt.Fprintf(&sb, `,{"role":"assistant","content":null,"tool_calls":[{"id":"call_%d","type":"function","function":{"name":"lookup","arguments":"{\"n\":%d}"}}]}`, i, i)
+		fmt.Fprintf(&sb, `,{"role":"tool","tool_call_id":"call_%d","content":"result %d"}`, i, i)
+	}
+	sb.WriteString(`],"tools":[{"type":"function","function":{"name":"lookup","parameters":{"type":"object"}}}],"reasoning_effort":"high"}`)
+	inputJSON := []byte(sb.String())
+
+	expected, err := ConvertOpenAIRequestToCodexE("gpt-5.2", inputJSON, true)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	var buf strings.Builder
+	if err = WriteOpenAIRequestToCodex(&buf, "gpt-5.2", inputJSON, true); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if buf.String() != string(expected) {
+		t.Fatalf("Expected streamed output to match in-memory output\nstreamed: %s\nexpected: %s", buf.String(), expected)
+	}
+	if n := len(gjson.Get(buf.String(), "input").Array()); n != 801 {
+		t.Errorf("Expected 801 input items, got %d", n)
+	}
+
+	buf.Reset()
+	if err = WriteOpenAIRequestToCodex(&buf, "gpt-5.2", []byte(`[]`), true); err == nil {
+		t.Error("Expected an error for a rejected request")
+	}
+	if buf.Len() != 0 {
+		t.Errorf("Expected nothing written for a rejected request, got %q", buf.String())
+	}
+}
+
+// TestConvertOpenAIRequestToCodex_DuplicateToolNames tests that identically named tools keep a
+// single name so calls still match, and that the strict variant reports the duplicate
+func TestConvertOpenAIRequestToCodex_DuplicateToolNames(t *testing.T) {
+	longName := "mcp__server__" + strings.Repeat("n", 70)
+	inputJSON := []byte(`{
+		"model": "gpt-5.2",
+		"messages": [
+			{"role": "user", "content": "Search"},
+			{"role": "assistant", "tool_calls": [
+				{"id": "call_1", "type": "function", "function": {"name": "search", "arguments": "{}"}},
+				{"id": "call_2", "type": "function", "function": {"name": "` + longName + `", "arguments": "{}"}}
+			]}
+		],
+		"tools": [
+			{"type": "function", "function": {"name": "search", "parameters": {"type": "object"}}},
+			{"type": "function", "function": {"name": "search", "parameters": {"type": "object"}}},
+			{"type": "function", "function": {"name": "` + longName + `", "parameters": {"type": "object"}}},
+			{"type": "function", "function": {"name": "` + longName + `", "parameters": {"type": "object"}}}
+		]
+	}`)
+
+	output := ConvertOpenAIRequestToCodex("gpt-5.2", inputJSON, false)
+
+	tools := gjson.GetBytes(output, "tools").Array()
+	if len(tools) != 2 {
+		t.Fatalf("Expected duplicate tools to collapse to 2, got %s", gjson.GetBytes(output, "tools").Raw)
+	}
+	if got := tools[0].Get("name").String(); got != "search" {
+		t.Errorf("Expected duplicated short name to stay 'search', got %q", got)
+	}
+	calls := gjson.GetBytes(output, `input.#(type=="function_call")#.name`).Array()
+	if len(calls) != 2 {
+		t.Fatalf("Expected 2 function calls, got %d", len(calls))
+	}
+	for i, call := range calls {
+		if got := tools[i].Get("name").String(); call.String() != got {
+			t.Errorf("Expected function call %d name %q to match tool name %q", i, call.String(), got)
+		}
+	}
+
+	if _, err := ConvertOpenAIRequestToCodexE("gpt-5.2", inputJSON, false); err == nil || !strings.Contains(err.Error(), "duplicate tool name") {
+		t.Errorf("Expected strict conversion to report the duplicate tool name, got %v", err)
+	}
+}
+
+// TestConvertOpenAIRequestToCodex_ImageURLMetadata tests that image detail is carried, mime_type is
+// carried only when enabled, and unknown image_url fields are dropped
+func TestConvertOpenAIRequestToCodex_ImageURLMetadata(t *testing.T) {
+	inputJSON := []byte(`{
+		"model": "gpt-5.2",
+		"messages": [{"role": "user", "content": [
+			{"type": "image_url", "image_url": {"url": "https://example.com/cat.png", "detail": "high", "mime_type": "image/png", "size": 1024}}
+		]}]
+	}`)
+
+	output := ConvertOpenAIRequestToCodex("gpt-5.2", inputJSON, false)
+	part := gjson.GetBytes(output, "input.0.content.0")
+	if got := part.Get("detail").String(); got != "high" {
+		t.Errorf("Expected detail 'high', got %q", got)
+	}
+	if part.Get("mime_type").Exists() || part.Get("size").Exists() {
+		t.Errorf("Expected only recognized fields by default, got %s", part.Raw)
+	}
+
+	output, err := ConvertOpenAIRequestToCodexWithOptions("gpt-5.2", inputJSON, false, Options{ForwardImageMimeType: true})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	part = gjson.GetBytes(output, "input.0.content.0")
+	expected := `{"type":"input_image","image_url":"https://example.com/cat.png","detail":"high","mime_type":"image/png"}`
+	if part.Raw != expected {
+		t.Errorf("Expected %s, got %s", expected, part.Raw)
+	}
+}
+
+// TestConvertOpenAICompletionRequestToCodex tests that string and array prompts become a single
+// user message
+func TestConvertOpenAICompletionRequestToCodex(t *testing.T) {
+	output := ConvertOpenAICompletionRequestToCodex("gpt-5.2", []byte(`{"model":"gpt-5.2","prompt":"Say hi"}`), false)
+	input := gjson.GetBytes(output, "input").Array()
+	if len(input) != 1 || input[0].Get("role").String() != "user" {
+		t.Fatalf("Expected a single user message, got %s", gjson.GetBytes(output, "input").Raw)
+	}
+	if got := input[0].Get("content.0.text").String(); got != "Say hi" {
+		t.Errorf("Expected prompt text 'Say hi', got %q", got)
+	}
+	if gjson.GetBytes(output, "prompt").Exists() {
+		t.Errorf("Expected prompt to be removed, got %s", output)
+	}
+
+	output = ConvertOpenAICompletionRequestToCodex("gpt-5.2", []byte(`{"model":"gpt-5.2","prompt":["First","Second"]}`), false)
+	input = gjson.GetBytes(output, "input").Array()
+	if len(input) != 1 {
+		t.Fatalf("Expected a single user message, got %s", gjson.GetBytes(output, "input").Raw)
+	}
+	texts := input[0].Get("content.#.text").Array()
+	if len(texts) != 2 || texts[0].String() != "First" || texts[1].String() != "Second" {
+		t.Errorf("Expected text parts [First Second], got %s", input[0].Get("content").Raw)
+	}
+}
+
+// TestConvertOpenAIRequestToCodex_DanglingBuiltinToolChoice tests that a built-in tool_choice without
+// a matching tool is rejected by the strict variant and omitted by the lenient one
+func TestConvertOpenAIRequestToCodex_DanglingBuiltinToolChoice(t *testing.T) {
+	inputJSON := []byte(`{
+		"model": "gpt-5.2",
+		"messages": [{"role": "user", "content": "Find the spec"}],
+		"tools": [{"type": "web_search"}],
+		"tool_choice": {"type": "file_search"}
+	}`)
+
+	if _, err := ConvertOpenAIRequestToCodexE("gpt-5.2", inputJSON, false); err == nil || !strings.Contains(err.Error(), "file_search") {
+		t.Errorf("Expected strict conversion to reject the dangling tool_choice, got %v", err)
+	}
+
+	output := ConvertOpenAIRequestToCodex("gpt-5.2", inputJSON, false)
+	if gjson.GetBytes(output, "tool_choice").Exists() {
+		t.Errorf("Expected lenient conversion to omit tool_choice, got %s", gjson.GetBytes(output, "tool_choice").Raw)
+	}
+
+	matched := []byte(`{
+		"model": "gpt-5.2",
+		"messages": [{"role": "user", "content": "Find the spec"}],
+		"tools": [{"type": "file_search", "vector_store_ids": ["vs_1"]}],
+		"tool_choice": {"type": "file_search"}
+	}`)
+	output, err := ConvertOpenAIRequestToCodexE("gpt-5.2", matched, false)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if got := gjson.GetBytes(output, "tool_choice.type").String(); got != "file_search" {
+		t.Errorf("Expected tool_choice file_search to be kept, got %q", got)
+	}
+}
+
+// TestConvertOpenAIRequestToCodex_PreserveMessageMetadata tests that message metadata is only
+// carried onto the message item when the option is enabled
+func TestConvertOpenAIRequestToCodex_PreserveMessageMetadata(t *testing.T) {
+	inputJSON := []byte(`{
+		"model": "gpt-5.2",
+		"messages": [{"role": "user", "content": "Hi", "metadata": {"turn": "t-1", "source": "replay"}}]
+	}`)
+
+	output := ConvertOpenAIRequestToCodex("gpt-5.2", inputJSON, false)
+	if gjson.GetBytes(output, "input.0.metadata").Exists() {
+		t.Errorf("Expected metadata to be dropped by default, got %s", gjson.GetBytes(output, "input.0").Raw)
+	}
+
+	output, err := ConvertOpenAIRequestToCodexWithOptions("gpt-5.2", inputJSON, false, Options{PreserveMessageMetadata: true})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if got := gjson.GetBytes(output, "input.0.metadata").Raw; got != `{"turn": "t-1", "source": "replay"}` {
+		t.Errorf("Expected metadata to survive on the user message, got %s", got)
+	}
+}
+
+// largeTextRequest builds a request whose single user message holds about 5MB of text that needs
+// JSON escaping.
+func largeTextRequest(tb testing.TB) []byte {
+	text := strings.Repeat("lorem \"ipsum\" ", 5<<20/14)
+	req, err := sjson.SetBytes([]byte(`{"model":"gpt-5.2","messages":[{"role":"user","content":""}]}`), "messages.0.content", text)
+	if err != nil {
+		tb.Fatalf("Unexpected error: %v", err)
+	}
+	return req
+}
+
+// allocatedBytes returns the number of bytes allocated while running f.
+func allocatedBytes(f func()) uint64 {
+	var before, after runtime.MemStats
+	runtime.GC()
+	runtime.ReadMemStats(&before)
+	f()
+	runtime.ReadMemStats(&after)
+	return after.TotalAlloc - before.TotalAlloc
+}
+
+// TestConvertOpenAIRequestToCodex_LargeTextAllocations tests that text forwarded unchanged reuses the
+// client's escaped string and allocates less than text that has to be escaped again
+func TestConvertOpenAIRequestToCodex_LargeTextAllocations(t *testing.T) {
+	req := largeTextRequest(t)
+
+	var output []byte
+	reused := allocatedBytes(func() { output = ConvertOpenAIRequestToCodex("gpt-5.2", req, false) })
+	if got, want := gjson.GetBytes(output, "input.0.content.0.text").String(), gjson.GetBytes(req, "messages.0.content").String(); got != want {
+		t.Fatalf("Expected the text to be forwarded unchanged, got %d bytes instead of %d", len(got), len(want))
+	}
+
+	// TrimTextParts rewrites the text, which forces it to be escaped again.
+	escaped := allocatedBytes(func() {
+		_, _ = ConvertOpenAIRequestToCodexWithOptions("gpt-5.2", req, false, Options{TrimTextParts: true})
+	})
+	if reused >= escaped {
+		t.Errorf("Expected forwarding unchanged text to allocate less than re-escaping it, got %d >= %d bytes", reused, escaped)
+	}
+}
+
+// BenchmarkConvertOpenAIRequestToCodex_LargeText measures converting a request with a 5MB text part.
+func BenchmarkConvertOpenAIRequestToCodex_LargeText(b *testing.B) {
+	req := largeTextRequest(b)
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		ConvertOpenAIRequestToCodex("gpt-5.2", req, false)
+	}
+}
+
+// TestConvertOpenAIRequestToCodex_HoistSystemToInstructions tests that only the first system message
+// becomes instructions when hoisting is enabled and that nothing is hoisted by default
+func TestConvertOpenAIRequestToCodex_HoistSystemToInstructions(t *testing.T) {
+	inputJSON := []byte(`{
+		"model": "gpt-5.2",
+		"messages": [
+			{"role": "system", "content": [{"type": "text", "text": "Be brief."}, {"type": "text", "text": "Use English."}]},
+			{"role": "system", "content": "Never guess."},
+			{"role": "user", "content": "Hi"}
+		]
+	}`)
+
+	output := ConvertOpenAIRequestToCodex("gpt-5.2", inputJSON, false)
+	if got := gjson.GetBytes(output, "instructions").String(); got != "" {
+		t.Errorf("Expected empty instructions by default, got %q", got)
+	}
+	if got := gjson.GetBytes(output, `input.#(role=="developer")#`).Array(); len(got) != 2 {
+		t.Errorf("Expected both system messages to stay in the input by default, got %d", len(got))
+	}
+
+	output, err := ConvertOpenAIRequestToCodexWithOptions("gpt-5.2", inputJSON, false, Options{HoistSystemToInstructions: true})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if got := gjson.GetBytes(output, "instructions").String(); got != "Be brief.\nUse English." {
+		t.Errorf("Expected the first system message as instructions, got %q", got)
+	}
+	input := gjson.GetBytes(output, "input").Array()
+	if len(input) != 2 {
+		t.Fatalf("Expected 2 input items, got %s", gjson.GetBytes(output, "input").Raw)
+	}
+	if input[0].Get("role").String() != "developer" || input[0].Get("content.0.text").String() != "Never guess." {
+		t.Errorf("Expected the second system message to remain as a developer message, got %s", input[0].Raw)
+	}
+	if input[1].Get("role").String() != "user" {
+		t.Errorf("Expected the user message last, got %s", input[1].Raw)
+	}
+}
+
+// fakeCounters records conversion events for tests.
+type fakeCounters map[string]int
+
+func (c fakeCounters) Inc(event string) { c[event]++ }
+
+// TestConvertOpenAIRequestToCodex_Counters tests that shortening, stripping and dropped content are
+// reported to the caller's counters
+func TestConvertOpenAIRequestToCodex_Counters(t *testing.T) {
+	longName := "mcp__" + strings.Repeat("server_", 10) + "__lookup"
+	longID := "call_" + strings.Repeat("x", 80)
+	inputJSON := []byte(`{
+		"model": "gpt-5.2",
+		"temperature": 0.2,
+		"top_p": 0.9,
+		"messages": [
+			{"role": "user", "content": [{"type": "text", "text": "Look it up"}, {"type": "file", "file": {"file_id": "f_1"}}]},
+			{"role": "assistant", "content": null, "tool_calls": [{"id": "` + longID + `", "type": "function", "function": {"name": "` + longName + `", "arguments": "{}"}}]},
+			{"role": "tool", "tool_call_id": "` + longID + `", "content": "done"}
+		],
+		"tools": [{"type": "function", "function": {"name": "` + longName + `", "parameters": {"type": "object"}}}]
+	}`)
+
+	counters := fakeCounters{}
+	if _, err := ConvertOpenAIRequestToCodexWithOptions("gpt-5.2", inputJSON, false, Options{Counters: counters}); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	expected := map[string]int{
+		common.EventToolNameShortened:         1,
+		common.EventCallIDShortened:           1,
+		common.EventFieldStripped:             2,
+		common.EventUnsupportedContentDropped: 1,
+	}
+	for event, want := range expected {
+		if got := counters[event]; got != want {
+			t.Errorf("Expected %s to be counted %d times, got %d", event, want, got)
+		}
+	}
+}
+
+// TestConvertOpenAIRequestToCodex_WrapperlessToolCalls tests that tool_calls entries carrying name and
+// arguments without a function wrapper are converted to function_call items
+func TestConvertOpenAIRequestToCodex_WrapperlessToolCalls(t *testing.T) {
+	inputJSON := []byte(`{
+		"model": "gpt-5.2",
+		"messages": [
+			{"role": "user", "content": "Weather in Paris?"},
+			{"role": "assistant", "content": null, "tool_calls": [{"id": "call_1", "name": "get_weather", "arguments": "{\"city\":\"Paris\"}"}]},
+			{"role": "tool", "tool_call_id": "call_1", "content": "Sunny"}
+		],
+		"tools": [{"type": "function", "function": {"name": "get_weather", "parameters": {"type": "object"}}}]
+	}`)
+
+	output := ConvertOpenAIRequestToCodex("gpt-5.2", inputJSON, false)
+
+	call := gjson.GetBytes(output, `input.#(type=="function_call")`)
+	if !call.Exists() {
+		t.Fatalf("Expected a function_call item, got %s", gjson.GetBytes(output, "input").Raw)
+	}
+	if got := call.Get("name").String(); got != "get_weather" {
+		t.Errorf("Expected name get_weather, got %q", got)
+	}
+	if got := call.Get("call_id").String(); got != "call_1" {
+		t.Errorf("Expected call_id call_1, got %q", got)
+	}
+	if got := call.Get("arguments").String(); got != `{"city":"Paris"}` {
+		t.Errorf("Expected arguments to be carried, got %q", got)
+	}
+}
+
+// TestConvertOpenAIRequestToCodex_ImageOnlyUserTurn tests that image-only user turns, including ones
+// with an empty text part, produce a single input_image part
+func TestConvertOpenAIRequestToCodex_ImageOnlyUserTurn(t *testing.T) {
+	cases := map[string]string{
+		"image only":      `[{"type": "image_url", "image_url": {"url": "https://example.com/a.png"}}]`,
+		"empty text part": `[{"type": "text", "text": ""}, {"type": "image_url", "image_url": {"url": "https://example.com/a.png"}}]`,
+	}
+	for name, content := range cases {
+		inputJSON := []byte(`{"model": "gpt-5.2", "messages": [{"role": "user", "content": ` + content + `}]}`)
+		output := ConvertOpenAIRequestToCodex("gpt-5.2", inputJSON, false)
+
+		parts := gjson.GetBytes(output, "input.0.content").Array()
+		if len(parts) != 1 || parts[0].Get("type").String() != "input_image" {
+			t.Errorf("%s: expected a single input_image part, got %s", name, gjson.GetBytes(output, "input.0.content").Raw)
+		}
+	}
+}
+
+// TestConvertOpenAIRequestToCodex_NullOptionalFields tests that explicitly null optional fields are
+// treated as omitted
+func TestConvertOpenAIRequestToCodex_NullOptionalFields(t *testing.T) {
+	inputJSON := []byte(`{
+		"model": "gpt-5.2",
+		"messages": [{"role": "user", "content": "Hi"}],
+		"tool_choice": null,
+		"response_format": null,
+		"reasoning_effort": null,
+		"text": {"verbosity": null}
+	}`)
+
+	output, err := ConvertOpenAIRequestToCodexE("gpt-5.2", inputJSON, false)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if gjson.GetBytes(output, "tool_choice").Exists() {
+		t.Errorf("Expected no tool_choice, got %s", gjson.GetBytes(output, "tool_choice").Raw)
+	}
+	if gjson.GetBytes(output, "text").Exists() {
+		t.Errorf("Expected no text settings, got %s", gjson.GetBytes(output, "text").Raw)
+	}
+	if got := gjson.GetBytes(output, "reasoning.effort").String(); got != "medium" {
+		t.Errorf("Expected default reasoning effort medium, got %q", got)
+	}
+}
+
+// TestConvertOpenAIRequestToCodex_ParallelToolOutputsPairing tests that outputs of parallel tool calls
+// sent back in a different order keep their call_id pairing, and follow call order when grouped
+func TestConvertOpenAIRequestToCodex_ParallelToolOutputsPairing(t *testing.T) {
+	inputJSON := []byte(`{
+		"model": "gpt-5.2",
+		"messages": [
+			{"role": "user", "content": "Weather in Paris and Rome?"},
+			{"role": "assistant", "content": null, "tool_calls": [
+				{"id": "call_paris", "type": "function", "function": {"name": "get_weather", "arguments": "{\"city\":\"Paris\"}"}},
+				{"id": "call_rome", "type": "function", "function": {"name": "get_weather", "arguments": "{\"city\":\"Rome\"}"}}
+			]},
+			{"role": "tool", "tool_call_id": "call_rome", "content": "Rome: sunny"},
+			{"role": "tool", "tool_call_id": "call_paris", "content": "Paris: rain"}
+		],
+		"tools": [{"type": "function", "function": {"name": "get_weather", "parameters": {"type": "object"}}}]
+	}`)
+	expectedOutputs := map[string]string{"call_paris": "Paris: rain", "call_rome": "Rome: sunny"}
+
+	checkPairs := func(output []byte, wantOrder []string) {
+		t.Helper()
+		calls := gjson.GetBytes(output, `input.#(type=="function_call")#.call_id`).Array()
+		if len(calls) != 2 || calls[0].String() != "call_paris" || calls[1].String() != "call_rome" {
+			t.Fatalf("Expected calls [call_paris call_rome], got %v", calls)
+		}
+		outputs := gjson.GetBytes(output, `input.#(type=="function_call_output")#`).Array()
+		if len(outputs) != len(wantOrder) {
+			t.Fatalf("Expected %d outputs, got %d", len(wantOrder), len(outputs))
+		}
+		for i, out := range outputs {
+			callID := out.Get("call_id").String()
+			if callID != wantOrder[i] {
+				t.Errorf("Expected output %d for %s, got %s", i, wantOrder[i], callID)
+			}
+			if got := out.Get("output").String(); got != expectedOutputs[callID] {
+				t.Errorf("Expected output for %s to be %q, got %q", callID, expectedOutputs[callID], got)
+			}
+		}
+	}
+
+	checkPairs(ConvertOpenAIRequestToCodex("gpt-5.2", inputJSON, false), []string{"call_rome", "call_paris"})
+
+	grouped, err := ConvertOpenAIRequestToCodexWithOptions("gpt-5.2", inputJSON, false, Options{GroupFunctionCalls: true})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	checkPairs(grouped, []string{"call_paris", "call_rome"})
+}
+
+// TestConvertOpenAIRequestToCodex_InstructionsPrefix tests that the prefix is prepended to the
+// instructions and not duplicated when a replayed turn already carries it
+func TestConvertOpenAIRequestToCodex_InstructionsPrefix(t *testing.T) {
+	const prefix = "You are Codex, a coding agent."
+	opts := Options{InstructionsPrefix: prefix, HoistSystemToInstructions: true}
+
+	first := []byte(`{"model": "gpt-5.2", "messages": [{"role": "system", "content": "Be brief."}, {"role": "user", "content": "Hi"}]}`)
+	output, err := ConvertOpenAIRequestToCodexWithOptions("gpt-5.2", first, false, opts)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if got := gjson.GetBytes(output, "instructions").String(); got != prefix+"\n\nBe brief." {
+		t.Errorf("Expected the prefix ahead of the system text, got %q", got)
+	}
+
+	replayed := []byte(`{"model": "gpt-5.2", "messages": [
+		{"role": "system", "content": "` + prefix + `\n\nBe brief."},
+		{"role": "user", "content": "Hi"},
+		{"role": "assistant", "content": "Hello"},
+		{"role": "user", "content": "Again"}
+	]}`)
+	output, err = ConvertOpenAIRequestToCodexWithOptions("gpt-5.2", replayed, false, opts)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if got := gjson.GetBytes(output, "instructions").String(); strings.Count(got, prefix) != 1 {
+		t.Errorf("Expected the prefix exactly once, got %q", got)
+	}
+
+	opts.HoistSystemToInstructions = false
+	output, err = ConvertOpenAIRequestToCodexWithOptions("gpt-5.2", replayed, false, opts)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if got := gjson.GetBytes(output, "instructions").String(); got != "" {
+		t.Errorf("Expected no prefix when a developer message already carries it, got %q", got)
+	}
+}
+
+// TestConvertOpenAIRequestToCodex_DefaultReasoningEffortPerModel tests that the per-model default
+// applies only when the request sets no reasoning effort
+func TestConvertOpenAIRequestToCodex_DefaultReasoningEffortPerModel(t *testing.T) {
+	opts := Options{DefaultReasoningEfforts: map[string]string{"gpt-5.2-mini": "low"}}
+	cases := []struct {
+		model string
+		body  string
+		want  string
+	}{
+		{"gpt-5.2-mini", `{"messages":[{"role":"user","content":"Hi"}]}`, "low"},
+		{"gpt-5.2", `{"messages":[{"role":"user","content":"Hi"}]}`, "medium"},
+		{"gpt-5.2-mini", `{"reasoning_effort":"high","messages":[{"role":"user","content":"Hi"}]}`, "high"},
+	}
+	for _, tc := range cases {
+		output, err := ConvertOpenAIRequestToCodexWithOptions(tc.model, []byte(tc.body), false, opts)
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		if got := gjson.GetBytes(output, "reasoning.effort").String(); got != tc.want {
+			t.Errorf("Expected effort %q for %s, got %q", tc.want, tc.model, got)
+		}
+	}
+}
+
+// TestConvertOpenAIRequestToCodex_ResponsesShapedTextParts tests that input_text and output_text parts
+// in a Chat Completions request are kept and typed for their role
+func TestConvertOpenAIRequestToCodex_ResponsesShapedTextParts(t *testing.T) {
+	inputJSON := []byte(`{
+		"model": "gpt-5.2",
+		"messages": [
+			{"role": "user", "content": [{"type": "input_text", "text": "Hi"}, {"type": "text", "text": "there"}]},
+			{"role": "assistant", "content": [{"type": "output_text", "text": "Hello"}]},
+			{"role": "user", "content": [{"type": "output_text", "text": "Pasted"}]}
+		]
+	}`)
+
+	output := ConvertOpenAIRequestToCodex("gpt-5.2", inputJSON, false)
+
+	expected := []struct {
+		index    int
+		partType string
+		texts    []string
+	}{
+		{0, "input_text", []string{"Hi", "there"}},
+		{1, "output_text", []string{"Hello"}},
+		{2, "input_text", []string{"Pasted"}},
+	}
+	for _, want := range expected {
+		parts := gjson.GetBytes(output, fmt.Sprintf("input.%d.content", want.index)).Array()
+		if len(parts) != len(want.texts) {
+			t.Fatalf("Expected %d parts in message %d, got %d", len(want.texts), want.index, len(parts))
+		}
+		for i, part := range parts {
+			if part.Get("type").String() != want.partType || part.Get("text").String() != want.texts[i] {
+				t.Errorf("Expected %s %q in message %d, got %s", want.partType, want.texts[i], want.index, part.Raw)
+			}
+		}
+	}
+}
+
+// TestConvertOpenAIRequestToCodex_HoistOnlyLeadingSystemMessage tests that only a system or developer
+// message at the start of the conversation is hoisted
+func TestConvertOpenAIRequestToCodex_HoistOnlyLeadingSystemMessage(t *testing.T) {
+	opts := Options{HoistSystemToInstructions: true}
+
+	inputJSON := []byte(`{
+		"model": "gpt-5.2",
+		"messages": [
+			{"role": "developer", "content": "Be brief."},
+			{"role": "user", "content": "Hi"},
+			{"role": "system", "content": "Switch to French."},
+			{"role": "user", "content": "Again"}
+		]
+	}`)
+	output, err := ConvertOpenAIRequestToCodexWithOptions("gpt-5.2", inputJSON, false, opts)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if got := gjson.GetBytes(output, "instructions").String(); got != "Be brief." {
+		t.Errorf("Expected the leading message as instructions, got %q", got)
+	}
+	roles := gjson.GetBytes(output, "input.#.role").Array()
+	if len(roles) != 3 || roles[0].String() != "user" || roles[1].String() != "developer" || roles[2].String() != "user" {
+		t.Fatalf("Expected roles [user developer user], got %v", roles)
+	}
+	if got := gjson.GetBytes(output, "input.1.content.0.text").String(); got != "Switch to French." {
+		t.Errorf("Expected the later system message to stay in place, got %q", got)
+	}
+
+	notLeading := []byte(`{
+		"model": "gpt-5.2",
+		"messages": [
+			{"role": "user", "content": "Hi"},
+			{"role": "system", "content": "Switch to French."}
+		]
+	}`)
+	output, err = ConvertOpenAIRequestToCodexWithOptions("gpt-5.2", notLeading, false, opts)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if got := gjson.GetBytes(output, "instructions").String(); got != "" {
+		t.Errorf("Expected nothing to be hoisted, got %q", got)
+	}
+	if got := gjson.GetBytes(output, "input.#").Int(); got != 2 {
+		t.Errorf("Expected both messages to stay in the input, got %d", got)
+	}
+}
+
+// TestConvertOpenAIRequestToCodex_FormatToolChoiceConflict tests that a json_schema response_format
+// together with a forced tool_choice is rejected, while each alone passes
+func TestConvertOpenAIRequestToCodex_FormatToolChoiceConflict(t *testing.T) {
+	const format = `"response_format": {"type": "json_schema", "json_schema": {"name": "answer", "schema": {"type": "object"}}}`
+	const choice = `"tool_choice": {"type": "function", "function": {"name": "lookup"}}`
+	build := func(fields ...string) []byte {
+		body := `{"model": "gpt-5.2", "messages": [{"role": "user", "content": "Hi"}], "tools": [{"type": "function", "function": {"name": "lookup", "parameters": {"type": "object"}}}]`
+		for _, field := range fields {
+			body += ", " + field
+		}
+		return []byte(body + "}")
+	}
+	opts := Options{RejectFormatToolChoiceConflict: true}
+
+	if _, err := ConvertOpenAIRequestToCodexWithOptions("gpt-5.2", build(format, choice), false, opts); err == nil || !strings.Contains(err.Error(), "tool_choice") {
+		t.Errorf("Expected the conflicting combination to be rejected, got %v", err)
+	}
+	if _, err := ConvertOpenAIRequestToCodexWithOptions("gpt-5.2", build(format, `"tool_choice": "required"`), false, opts); err == nil {
+		t.Error("Expected json_schema with tool_choice required to be rejected")
+	}
+	if _, err := ConvertOpenAIRequestToCodexWithOptions("gpt-5.2", build(format), false, opts); err != nil {
+		t.Errorf("Expected response_format alone to pass, got %v", err)
+	}
+	if _, err := ConvertOpenAIRequestToCodexWithOptions("gpt-5.2", build(choice), false, opts); err != nil {
+		t.Errorf("Expected tool_choice alone to pass, got %v", err)
+	}
+	if _, err := ConvertOpenAIRequestToCodexE("gpt-5.2", build(format, choice), false); err != nil {
+		t.Errorf("Expected the check to be off by default, got %v", err)
+	}
+}
+
+// TestConvertOpenAIRequestToCodex_DeterministicMode tests that the preset pins the seed and effort and
+// disables reasoning summaries
+func TestConvertOpenAIRequestToCodex_DeterministicMode(t *testing.T) {
+	withoutSeed := []byte(`{"model": "gpt-5.2", "reasoning_effort": "high", "messages": [{"role": "user", "content": "Hi"}]}`)
+	output, err := ConvertOpenAIRequestToCodexWithOptions("gpt-5.2", withoutSeed, false, DeterministicMode())
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if got := gjson.GetBytes(output, "seed").Int(); got != deterministicSeed {
+		t.Errorf("Expected fixed seed %d, got %d", deterministicSeed, got)
+	}
+	if got := gjson.GetBytes(output, "reasoning.effort").String(); got != "low" {
+		t.Errorf("Expected effort low, got %q", got)
+	}
+	if gjson.GetBytes(output, "reasoning.summary").Exists() {
+		t.Errorf("Expected no reasoning summary, got %s", gjson.GetBytes(output, "reasoning").Raw)
+	}
+
+	withSeed := []byte(`{"model": "gpt-5.2", "seed": 7, "messages": [{"role": "user", "content": "Hi"}]}`)
+	output, err = ConvertOpenAIRequestToCodexWithOptions("gpt-5.2", withSeed, false, DeterministicMode())
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if got := gjson.GetBytes(output, "seed").Int(); got != 7 {
+		t.Errorf("Expected the request seed 7, got %d", got)
+	}
+
+	output = ConvertOpenAIRequestToCodex("gpt-5.2", withSeed, false)
+	if gjson.GetBytes(output, "seed").Exists() {
+		t.Errorf("Expected seed to be dropped by default, got %s", output)
+	}
+}
+
+// TestConvertOpenAIRequestToCodex_AssistantGeneratedImage tests that an image in an assistant turn is
+// replayed as an image_generation_call item after the message
+func TestConvertOpenAIRequestToCodex_AssistantGeneratedImage(t *testing.T) {
+	inputJSON := []byte(`{
+		"model": "gpt-5.2",
+		"messages": [
+			{"role": "user", "content": "Draw a cat"},
+			{"role": "assistant", "content": [
+				{"type": "text", "text": "Here is your cat."},
+				{"type": "image_url", "image_url": {"url": "data:image/png;base64,iVBORw0KGgo="}},
+				{"type": "image_url", "image_url": {"url": "https://example.com/cat.png"}}
+			]},
+			{"role": "user", "content": "Make it orange"}
+		]
+	}`)
+
+	output := ConvertOpenAIRequestToCodex("gpt-5.2", inputJSON, false)
+
+	types := gjson.GetBytes(output, "input.#.type").Array()
+	if len(types) != 4 || types[2].String() != "image_generation_call" {
+		t.Fatalf("Expected the image_generation_call after the assistant message, got %s", gjson.GetBytes(output, "input").Raw)
+	}
+	item := gjson.GetBytes(output, "input.2")
+	if got := item.Get("result").String(); got != "iVBORw0KGgo=" {
+		t.Errorf("Expected the base64 image as result, got %q", got)
+	}
+	if got := item.Get("status").String(); got != "completed" {
+		t.Errorf("Expected status completed, got %q", got)
+	}
+	if !strings.HasPrefix(item.Get("id").String(), "ig_") {
+		t.Errorf("Expected an ig_ id, got %q", item.Get("id").String())
+	}
+	parts := gjson.GetBytes(output, "input.1.content").Array()
+	if len(parts) != 1 || parts[0].Get("type").String() != "output_text" {
+		t.Errorf("Expected only the text to stay on the assistant message, got %s", gjson.GetBytes(output, "input.1.content").Raw)
+	}
+}
+
+// TestConvertOpenAIRequestToCodex_MaxTools tests the error and truncate strategies of the tool count
+// limit
+func TestConvertOpenAIRequestToCodex_MaxTools(t *testing.T) {
+	inputJSON := []byte(`{
+		"model": "gpt-5.2",
+		"messages": [{"role": "user", "content": "Hi"}],
+		"tools": [
+			{"type": "function", "function": {"name": "a", "parameters": {"type": "object"}}},
+			{"type": "function", "function": {"name": "b", "parameters": {"type": "object"}}},
+			{"type": "function", "function": {"name": "c", "parameters": {"type": "object"}}}
+		]
+	}`)
+
+	if _, err := ConvertOpenAIRequestToCodexWithOptions("gpt-5.2", inputJSON, false, Options{MaxTools: 2}); err == nil || !strings.Contains(err.Error(), "limit of 2") {
+		t.Errorf("Expected the tool count to be rejected, got %v", err)
+	}
+
+	output, err := ConvertOpenAIRequestToCodexWithOptions("gpt-5.2", inputJSON, false, Options{MaxTools: 2, TruncateTools: true})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	names := gjson.GetBytes(output, "tools.#.name").Array()
+	if len(names) != 2 || names[0].String() != "a" || names[1].String() != "b" {
+		t.Errorf("Expected tools [a b], got %v", names)
+	}
+
+	if _, err := ConvertOpenAIRequestToCodexWithOptions("gpt-5.2", inputJSON, false, Options{MaxTools: 3}); err != nil {
+		t.Errorf("Expected a request at the limit to pass, got %v", err)
+	}
+}
+
+// TestConvertOpenAIRequestToCodex_PreserveUnknownFields tests that vendor fields survive only when
+// the option is on and that known unsupported fields stay dropped
+func TestConvertOpenAIRequestToCodex_PreserveUnknownFields(t *testing.T) {
+	inputJSON := []byte(`{
+		"model": "gpt-5.2",
+		"temperature": 0.2,
+		"x-vendor-field": {"trace": true},
+		"messages": [{"role": "user", "content": "Hi"}]
+	}`)
+
+	output := ConvertOpenAIRequestToCodex("gpt-5.2", inputJSON, false)
+	if gjson.GetBytes(output, `x-vendor-field`).Exists() {
+		t.Errorf("Expected x-vendor-field to be dropped by default, got %s", output)
+	}
+
+	output, err := ConvertOpenAIRequestToCodexWithOptions("gpt-5.2", inputJSON, false, Options{PreserveUnknownFields: true})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if got := gjson.GetBytes(output, `x-vendor-field`).Raw; got != `{"trace": true}` {
+		t.Errorf("Expected x-vendor-field to survive, got %q", got)
+	}
+	if gjson.GetBytes(output, "temperature").Exists() {
+		t.Errorf("Expected temperature to stay dropped, got %s", output)
+	}
+	if got := gjson.GetBytes(output, "input.0.content.0.text").String(); got != "Hi" {
+		t.Errorf("Expected the input to be unaffected, got %q", got)
+	}
+}
+
+// TestConvertOpenAIRequestToCodexN tests that n:3 yields three identical payloads, with consecutive
+// seeds when seed forwarding is on
+func TestConvertOpenAIRequestToCodexN(t *testing.T) {
+	inputJSON := []byte(`{"model": "gpt-5.2", "n": 3, "seed": 10, "messages": [{"role": "user", "content": "Hi"}]}`)
+
+	payloads, err := ConvertOpenAIRequestToCodexN("gpt-5.2", inputJSON, false)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if len(payloads) != 3 {
+		t.Fatalf("Expected 3 payloads, got %d", len(payloads))
+	}
+	for i, payload := range payloads {
+		if string(payload) != string(payloads[0]) {
+			t.Errorf("Expected payload %d to match the first, got %s", i, payload)
+		}
+		if gjson.GetBytes(payload, "n").Exists() {
+			t.Errorf("Expected n to be dropped from payload %d", i)
+		}
+	}
+
+	payloads, err = ConvertOpenAIRequestToCodexNWithOptions("gpt-5.2", inputJSON, false, Options{ForwardSeed: true})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	for i, payload := range payloads {
+		if got := gjson.GetBytes(payload, "seed").Int(); got != int64(10+i) {
+			t.Errorf("Expected seed %d for payload %d, got %d", 10+i, i, got)
+		}
+	}
+
+	if _, err := ConvertOpenAIRequestToCodexN("gpt-5.2", []byte(`{"n": 0, "messages": []}`), false); err == nil {
+		t.Error("Expected n:0 to be rejected")
+	}
+	for _, n := range []string{"129", "1e15"} {
+		payloads, err := ConvertOpenAIRequestToCodexN("gpt-5.2", []byte(`{"n": `+n+`, "messages": [{"role": "user", "content": "Hi"}]}`), false)
+		if err == nil || payloads != nil {
+			t.Errorf("Expected n:%s to be rejected, got %d payloads", n, len(payloads))
+		}
+	}
+}
+
+// TestConvertOpenAIRequestToCodex_InlineSchemaRefs tests that a $ref to a $defs entry in function
+// parameters is inlined when the option is on
+func TestConvertOpenAIRequestToCodex_InlineSchemaRefs(t *testing.T) {
+	inputJSON := []byte(`{
+		"model": "gpt-5.2",
+		"messages": [{"role": "user", "content": "Ship it"}],
+		"tools": [{"type": "function", "function": {"name": "ship", "strict": true, "parameters": {
+			"type": "object",
+			"properties": {"to": {"$ref": "#/$defs/address"}},
+			"required": ["to"],
+			"$defs": {"address": {"type": "object", "properties": {"city": {"type": "string"}}, "required": ["city"]}}
+		}}}]
+	}`)
+
+	output := ConvertOpenAIRequestToCodex("gpt-5.2", inputJSON, false)
+	if !gjson.GetBytes(output, `tools.0.parameters.properties.to.\$ref`).Exists() {
+		t.Errorf("Expected the reference to be kept by default, got %s", gjson.GetBytes(output, "tools.0.parameters").Raw)
+	}
+
+	output, err := ConvertOpenAIRequestToCodexWithOptions("gpt-5.2", inputJSON, false, Options{InlineSchemaRefs: true})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	params := gjson.GetBytes(output, "tools.0.parameters")
+	if params.Get(`properties.to.\$ref`).Exists() || params.Get(`\$defs`).Exists() {
+		t.Errorf("Expected the reference and $defs to be gone, got %s", params.Raw)
+	}
+	if got := params.Get("properties.to.properties.city.type").String(); got != "string" {
+		t.Errorf("Expected the address definition to be inlined, got %s", params.Raw)
+	}
+}
+
+// TestConvertOpenAIRequestToCodex_RefusalWithToolCalls tests that an assistant turn carrying both a
+// refusal and tool calls keeps the refusal part and emits every call
+func TestConvertOpenAIRequestToCodex_RefusalWithToolCalls(t *testing.T) {
+	inputJSON := []byte(`{
+		"model": "gpt-5.2",
+		"messages": [
+			{"role": "user", "content": "Delete everything and check the weather"},
+			{"role": "assistant", "content": null, "refusal": "I can't delete everything.", "tool_calls": [
+				{"id": "call_1", "type": "function", "function": {"name": "get_weather", "arguments": "{\"city\":\"Paris\"}"}},
+				{"id": "call_2", "type": "function", "function": {"name": "get_weather", "arguments": "{\"city\":\"Rome\"}"}}
+			]}
+		],
+		"tools": [{"type": "function", "function": {"name": "get_weather", "parameters": {"type": "object"}}}]
+	}`)
+
+	output := ConvertOpenAIRequestToCodex("gpt-5.2", inputJSON, false)
+
+	input := gjson.GetBytes(output, "input").Array()
+	if len(input) != 4 {
+		t.Fatalf("Expected user, assistant and 2 function_call items, got %s", gjson.GetBytes(output, "input").Raw)
+	}
+	parts := input[1].Get("content").Array()
+	if input[1].Get("role").String() != "assistant" || len(parts) != 1 || parts[0].Get("type").String() != "refusal" {
+		t.Fatalf("Expected the assistant message to hold the refusal part, got %s", input[1].Raw)
+	}
+	if got := parts[0].Get("refusal").String(); got != "I can't delete everything." {
+		t.Errorf("Expected the refusal text, got %q", got)
+	}
+	for i, want := range []string{"call_1", "call_2"} {
+		item := input[2+i]
+		if item.Get("type").String() != "function_call" || item.Get("call_id").String() != want {
+			t.Errorf("Expected function_call %s at input %d, got %s", want, 2+i, item.Raw)
+		}
+	}
+}
+
+// TestConvertOpenAIRequestToCodex_MaxImageBytes tests that inline images under the limit pass, and
+// oversized ones are dropped or reported depending on the strategy
+func TestConvertOpenAIRequestToCodex_MaxImageBytes(t *testing.T) {
+	small := "data:image/png;base64," + strings.Repeat("A", 8)
+	large := "data:image/png;base64," + strings.Repeat("A", 400)
+	build := func(url string) []byte {
+		return []byte(`{"model":"gpt-5.2","messages":[{"role":"user","content":[{"type":"text","text":"Look"},{"type":"image_url","image_url":{"url":"` + url + `"}}]}]}`)
+	}
+
+	output, err := ConvertOpenAIRequestToCodexWithOptions("gpt-5.2", build(small), false, Options{MaxImageBytes: 100})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if got := gjson.GetBytes(output, "input.0.content.#").Int(); got != 2 {
+		t.Errorf("Expected the small image to be kept, got %s", gjson.GetBytes(output, "input.0.content").Raw)
+	}
+
+	output, err = ConvertOpenAIRequestToCodexWithOptions("gpt-5.2", build(large), false, Options{MaxImageBytes: 100, DropOversizedImages: true})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	parts := gjson.GetBytes(output, "input.0.content").Array()
+	if len(parts) != 1 || parts[0].Get("type").String() != "input_text" {
+		t.Errorf("Expected the large image to be dropped, got %s", gjson.GetBytes(output, "input.0.content").Raw)
+	}
+
+	if _, err = ConvertOpenAIRequestToCodexWithOptions("gpt-5.2", build(large), false, Options{MaxImageBytes: 100}); err == nil || !strings.Contains(err.Error(), "limit of 100") {
+		t.Errorf("Expected the large image to be reported, got %v", err)
+	}
+}
+
+// TestConvertOpenAIRequestToCodex_MaxImageBytesToolResult tests that the image limit applies to
+// images in tool results
+func TestConvertOpenAIRequestToCodex_MaxImageBytesToolResult(t *testing.T) {
+	large := "data:image/png;base64," + strings.Repeat("A", 400)
+	inputJSON := []byte(`{"model":"gpt-5.2","messages":[
+		{"role":"assistant","content":null,"tool_calls":[{"id":"call_1","type":"function","function":{"name":"screenshot","arguments":"{}"}}]},
+		{"role":"tool","tool_call_id":"call_1","content":[{"type":"text","text":"Captured"},{"type":"image_url","image_url":{"url":"` + large + `"}}]}
+	]}`)
+
+	output, err := ConvertOpenAIRequestToCodexWithOptions("gpt-5.2", inputJSON, false, Options{MaxImageBytes: 100, DropOversizedImages: true})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	result := gjson.GetBytes(output, `input.#(type=="function_call_output").output`)
+	if !result.IsArray() || len(result.Array()) != 1 || result.Get("0.type").String() != "input_text" {
+		t.Errorf("Expected the large image to be dropped from the tool result, got %s", result.Raw)
+	}
+
+	if _, err = ConvertOpenAIRequestToCodexWithOptions("gpt-5.2", inputJSON, false, Options{MaxImageBytes: 100}); err == nil || !strings.Contains(err.Error(), "messages[1].content[1]") {
+		t.Errorf("Expected the large tool result image to be reported, got %v", err)
+	}
+}
+
+// TestConvertOpenAIRequestToCodex_MessagesNotArray tests that a non-array messages field is reported
+// by the strict variant
+func TestConvertOpenAIRequestToCodex_MessagesNotArray(t *testing.T) {
+	for _, messages := range []string{`"hello"`, `{}`} {
+		inputJSON := []byte(`{"model": "gpt-5.2", "messages": ` + messages + `}`)
+		if _, err := ConvertOpenAIRequestToCodexE("gpt-5.2", inputJSON, false); err == nil || !strings.Contains(err.Error(), "messages must be an array") {
+			t.Errorf("Expected messages %s to be rejected, got %v", messages, err)
+		}
+	}
+}
+
+// TestConvertOpenAIRequestToCodex_ForceStrictToolsOverride tests that forcing strict mode leaves a
+// tool's explicit strict:false in place
+func TestConvertOpenAIRequestToCodex_ForceStrictToolsOverride(t *testing.T) {
+	inputJSON := []byte(`{
+		"model": "gpt-5.2",
+		"messages": [{"role": "user", "content": "Hi"}],
+		"tools": [
+			{"type": "function", "function": {"name": "strict_by_default", "parameters": {"type": "object"}}},
+			{"type": "function", "function": {"name": "loose", "strict": false, "parameters": {"type": "object"}}}
+		]
+	}`)
+
+	output, err := ConvertOpenAIRequestToCodexWithOptions("gpt-5.2", inputJSON, false, Options{ForceStrictTools: true})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if got := gjson.GetBytes(output, "tools.0.strict"); got.Type != gjson.True {
+		t.Errorf("Expected the first tool to be forced strict, got %s", gjson.GetBytes(output, "tools.0").Raw)
+	}
+	if got := gjson.GetBytes(output, "tools.1.strict"); got.Type != gjson.False {
+		t.Errorf("Expected the second tool to keep strict:false, got %s", gjson.GetBytes(output, "tools.1").Raw)
+	}
+
+	output = ConvertOpenAIRequestToCodex("gpt-5.2", inputJSON, false)
+	if gjson.GetBytes(output, "tools.0.strict").Exists() {
+		t.Errorf("Expected strict to stay unset by default, got %s", gjson.GetBytes(output, "tools.0").Raw)
+	}
+}
+
+// TestConvertOpenAIRequestToCodex_AssistantsNestedText tests that Assistants API text parts with the
+// text nested under value are mapped
+func TestConvertOpenAIRequestToCodex_AssistantsNestedText(t *testing.T) {
+	inputJSON := []byte(`{
+		"model": "gpt-5.2",
+		"messages": [
+			{"role": "user", "content": [{"type": "text", "text": {"value": "What is 2+2?", "annotations": []}}]},
+			{"role": "assistant", "content": [{"type": "text", "text": {"value": "4", "annotations": []}}]}
+		]
+	}`)
+
+	output := ConvertOpenAIRequestToCodex("gpt-5.2", inputJSON, false)
+
+	if got := gjson.GetBytes(output, "input.0.content.0.text").String(); got != "What is 2+2?" {
+		t.Errorf("Expected the user text from text.value, got %q", got)
+	}
+	if got := gjson.GetBytes(output, "input.1.content.0.text").String(); got != "4" {
+		t.Errorf("Expected the assistant text from text.value, got %q", got)
+	}
+	if got := gjson.GetBytes(output, "input.1.content.0.type").String(); got != "output_text" {
+		t.Errorf("Expected output_text for the assistant, got %q", got)
+	}
+}
+
+// TestConvertOpenAIRequestToCodex_IntegerReasoningEffort tests that integer effort levels are mapped
+// to effort names and out-of-range levels are reported
+func TestConvertOpenAIRequestToCodex_IntegerReasoningEffort(t *testing.T) {
+	output, err := ConvertOpenAIRequestToCodexE("gpt-5.2", []byte(`{"reasoning_effort": 3, "messages": [{"role": "user", "content": "Hi"}]}`), false)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if got := gjson.GetBytes(output, "reasoning.effort").String(); got != "high" {
+		t.Errorf("Expected effort high for level 3, got %q", got)
+	}
+
+	if _, err := ConvertOpenAIRequestToCodexE("gpt-5.2", []byte(`{"reasoning_effort": 7, "messages": [{"role": "user", "content": "Hi"}]}`), false); err == nil {
+		t.Error("Expected level 7 to be rejected")
+	}
+}
+
+// TestConvertOpenAIRequestToCodex_DoubleConversion tests that converting an already converted
+// request returns it unchanged
+func TestConvertOpenAIRequestToCodex_DoubleConversion(t *testing.T) {
+	input := []byte(`{
+		"model": "gpt-5.2",
+		"messages": [
+			{"role": "system", "content": "Be brief"},
+			{"role": "user", "content": "Hi"},
+			{"role": "assistant", "content": null, "tool_calls": [{"id": "call_1", "type": "function", "function": {"name": "lookup", "arguments": "{}"}}]},
+			{"role": "tool", "tool_call_id": "call_1", "content": "found"}
+		],
+		"tools": [{"type": "function", "function": {"name": "lookup", "parameters": {"type": "object"}}}]
+	}`)
+	first, err := ConvertOpenAIRequestToCodexE("gpt-5.2", input, true)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	second, err := ConvertOpenAIRequestToCodexE("gpt-5.2", first, true)
+	if err != nil {
+		t.Fatalf("Unexpected error on second conversion: %v", err)
+	}
+	if !bytes.Equal(first, second) {
+		t.Errorf("Expected second conversion to be a no-op.\nfirst:  %s\nsecond: %s", first, second)
+	}
+
+	var buf bytes.Buffer
+	if err := WriteOpenAIRequestToCodex(&buf, "gpt-5.2", first, true); err != nil {
+		t.Fatalf("Unexpected error writing: %v", err)
+	}
+	if !bytes.Equal(first, buf.Bytes()) {
+		t.Errorf("Expected written second conversion to be a no-op, got %s", buf.Bytes())
+	}
+}
+
+// TestConvertOpenAIRequestToCodex_CodexShapedInputIsRetargeted tests that a Codex-shaped request
+// takes the model and stream flag of the call and loses the fields Codex rejects
+func TestConvertOpenAIRequestToCodex_CodexShapedInputIsRetargeted(t *testing.T) {
+	first, err := ConvertOpenAIRequestToCodexE("gpt-5.2", []byte(`{"messages": [{"role": "user", "content": "Hi"}]}`), false)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	second, err := ConvertOpenAIRequestToCodexE("gpt-5.2-codex", first, true)
+	if err != nil {
+		t.Fatalf("Unexpected error on second conversion: %v", err)
+	}
+	if !gjson.GetBytes(second, "stream").Bool() {
+		t.Errorf("Expected stream true, got %s", second)
+	}
+	if got := gjson.GetBytes(second, "model").String(); got != "gpt-5.2-codex" {
+		t.Errorf("Expected model gpt-5.2-codex, got %q", got)
+	}
+	if got := gjson.GetBytes(second, "input").Raw; got != gjson.GetBytes(first, "input").Raw {
+		t.Errorf("Expected input to be kept, got %s", got)
+	}
+
+	responsesShaped := []byte(`{"model":"gpt-5.2","store":false,"include":["reasoning.encrypted_content"],"temperature":0.2,"max_output_tokens":64,"input":[{"type":"message","role":"user","content":[{"type":"input_text","text":"Hi"}]}]}`)
+	output, err := ConvertOpenAIRequestToCodexE("gpt-5.2", responsesShaped, true)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	for _, field := range []string{"temperature", "max_output_tokens"} {
+		if gjson.GetBytes(output, field).Exists() {
+			t.Errorf("Expected %s to be stripped, got %s", field, output)
+		}
+	}
+}
+
+// TestConvertOpenAIRequestToCodex_CountersSkipForwardedFields tests that fields forwarded or
+// consumed through an option are not counted as stripped
+func TestConvertOpenAIRequestToCodex_CountersSkipForwardedFields(t *testing.T) {
+	inputJSON := []byte(`{
+		"model": "gpt-5.2",
+		"x-vendor": {"trace": true},
+		"seed": 7,
+		"max_tokens": 64,
+		"metadata": {"reasoning_effort": "low"},
+		"stop": ["END"],
+		"messages": [{"role": "user", "content": "Hi"}]
+	}`)
+	opts := Options{PreserveUnknownFields: true, ForwardSeed: true, ForwardMaxOutputTokens: true, MetadataReasoningEffort: true}
+
+	counters := fakeCounters{}
+	opts.Counters = counters
+	if _, err := ConvertOpenAIRequestToCodexWithOptions("gpt-5.2", inputJSON, false, opts); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if got := counters[common.EventFieldStripped]; got != 1 {
+		t.Errorf("Expected only stop to be counted as stripped, got %d", got)
+	}
+
+	counters = fakeCounters{}
+	if _, err := ConvertOpenAIRequestToCodexWithOptions("gpt-5.2", inputJSON, false, Options{Counters: counters}); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if got := counters[common.EventFieldStripped]; got != 5 {
+		t.Errorf("Expected all 5 unmapped fields to be counted as stripped without options, got %d", got)
+	}
+}
+
+// TestValidInputItems tests that input items which are not valid JSON are dropped and reported
+func TestValidInputItems(t *testing.T) {
+	input := []string{`{"type":"message","role":"user","content":[]}`, `{"type":"message",`, `{"type":"function_call_output","call_id":"c","output":"ok"}`}
+
+	valid, err := validInputItems(input)
+	if err == nil || err.Error() != "input item 1 is not valid JSON" {
+		t.Errorf("Expected error for item 1, got %v", err)
+	}
+	if len(valid) != 2 || gjson.Get(valid[1], "type").String() != "function_call_output" {
+		t.Errorf("Expected the two valid items to be kept, got %v", valid)
+	}
+}
+
+// TestConvertOpenAIRequestToCodex_InlineToolCallPairsResult tests that an inline tool call
+// without an id is paired with the following tool result that has no tool_call_id
+func TestConvertOpenAIRequestToCodex_InlineToolCallPairsResult(t *testing.T) {
+	inputJSON := []byte(`{
+		"model": "gpt-5.2",
+		"messages": [
+			{"role": "user", "content": "What's the weather?"},
+			{"role": "assistant", "content": "{\"tool_call\": {\"name\": \"get_weather\", \"arguments\": {\"city\": \"Paris\"}}}"},
+			{"role": "tool", "content": "Sunny"}
+		]
+	}`)
+
+	output, err := ConvertOpenAIRequestToCodexWithOptions("gpt-5.2", inputJSON, true, Options{ParseInlineToolCalls: true})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	call := gjson.GetBytes(output, `input.#(type=="function_call")`)
+	result := gjson.GetBytes(output, `input.#(type=="function_call_output")`)
+	if call.Get("call_id").String() == "" || call.Get("call_id").String() != result.Get("call_id").String() {
+		t.Errorf("Expected the tool result to be paired with the inline call, got call %s and result %s", call.Raw, result.Raw)
+	}
+}
+
+// TestExtractInlineToolCalls_LargeMalformedText tests that long text full of braces and malformed
+// candidate blocks is scanned in bounded time and left unchanged
+func TestExtractInlineToolCalls_LargeMalformedText(t *testing.T) {
+	text := strings.Repeat(`{ {"tool_call": {"name": "a", `, 8000)
+
+	start := time.Now()
+	got, calls := extractInlineToolCalls(text)
+	if elapsed := time.Since(start); elapsed > 2*time.Second {
+		t.Errorf("Expected the scan to finish quickly, took %s", elapsed)
+	}
+	if len(calls) != 0 || got != text {
+		t.Errorf("Expected no calls and unchanged text, got %d calls", len(calls))
+	}
+}
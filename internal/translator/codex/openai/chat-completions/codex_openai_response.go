@@ -135,7 +135,7 @@ func ConvertCodexResponseToOpenAI(_ context.Context, modelName string, originalR
 
 		functionCallItemTemplate := `{"index":0,"id":"","type":"function","function":{"name":"","arguments":""}}`
 		functionCallItemTemplate, _ = sjson.Set(functionCallItemTemplate, "index", (*param).(*ConvertCliToOpenAIParams).FunctionCallIndex)
-		functionCallItemTemplate, _ = sjson.Set(functionCallItemTemplate, "id", itemResult.Get("call_id").String())
+		functionCallItemTemplate, _ = sjson.Set(functionCallItemTemplate, "id", restoreCallID(itemResult.Get("call_id").String(), originalRequestRawJSON))
 
 		// Restore original tool name if it was shortened.
 		name := itemResult.Get("name").String()
@@ -195,7 +195,7 @@ func ConvertCodexResponseToOpenAI(_ context.Context, modelName string, originalR
 		functionCallItemTemplate, _ = sjson.Set(functionCallItemTemplate, "index", (*param).(*ConvertCliToOpenAIParams).FunctionCallIndex)
 
 		template, _ = sjson.SetRaw(template, "choices.0.delta.tool_calls", `[]`)
-		functionCallItemTemplate, _ = sjson.Set(functionCallItemTemplate, "id", itemResult.Get("call_id").String())
+		functionCallItemTemplate, _ = sjson.Set(functionCallItemTemplate, "id", restoreCallID(itemResult.Get("call_id").String(), originalRequestRawJSON))
 
 		// Restore original tool name if it was shortened.
 		name := itemResult.Get("name").String()
@@ -317,7 +317,7 @@ func ConvertCodexResponseToOpenAINonStream(_ context.Context, _ string, original
 				functionCallTemplate := `{"id": "","type": "function","function": {"name": "","arguments": ""}}`
 
 				if callIdResult := outputItem.Get("call_id"); callIdResult.Exists() {
-					functionCallTemplate, _ = sjson.Set(functionCallTemplate, "id", callIdResult.String())
+					functionCallTemplate, _ = sjson.Set(functionCallTemplate, "id", restoreCallID(callIdResult.String(), originalRequestRawJSON))
 				}
 
 				if nameResult := outputItem.Get("name"); nameResult.Exists() {
@@ -370,9 +370,26 @@ func ConvertCodexResponseToOpenAINonStream(_ context.Context, _ string, original
 	return template
 }
 
+// restoreCallID maps a call ID shortened by the request translator back to the ID the client
+// originally sent. IDs that were not shortened are returned unchanged.
+func restoreCallID(callID string, original []byte) string {
+	if len(callID) == 0 {
+		return callID
+	}
+	for orig, short := range CallIDMap(original) {
+		if short == callID {
+			return orig
+		}
+	}
+	return callID
+}
+
 // buildReverseMapFromOriginalOpenAI builds a map of shortened tool name -> original tool name
 // from the original OpenAI-style request JSON using the same shortening logic.
 func buildReverseMapFromOriginalOpenAI(original []byte) map[string]string {
+	if isLegacyFunctionsRequest(original) {
+		original = legacyFunctionsToTools(original)
+	}
 	tools := gjson.GetBytes(original, "tools")
 	rev := map[string]string{}
 	if tools.IsArray() && len(tools.Array()) > 0 {
@@ -0,0 +1,49 @@
+package chat_completions
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/tidwall/gjson"
+)
+
+// TestConvertCodexResponseToOpenAINonStream_RestoresShortenedCallID tests that a call ID shortened
+// for Codex is recoverable from the original request and restored in the response
+func TestConvertCodexResponseToOpenAINonStream_RestoresShortenedCallID(t *testing.T) {
+	longID := "call_" + strings.Repeat("x", 80)
+	original := []byte(`{
+		"model": "gpt-5.2",
+		"messages": [
+			{"role": "user", "content": "Look it up"},
+			{"role": "assistant", "tool_calls": [{"id": "` + longID + `", "type": "function", "function": {"name": "lookup", "arguments": "{}"}}]},
+			{"role": "tool", "tool_call_id": "` + longID + `", "content": "done"}
+		]
+	}`)
+
+	ids := CallIDMap(original)
+	short, ok := ids[longID]
+	if !ok {
+		t.Fatalf("Expected the long call ID to be in the mapping, got %v", ids)
+	}
+	request := ConvertOpenAIRequestToCodex("gpt-5.2", original, false)
+	if got := gjson.GetBytes(request, `input.#(type=="function_call").call_id`).String(); got != short {
+		t.Fatalf("Expected the request to use the mapped short ID %q, got %q", short, got)
+	}
+
+	response := []byte(`{"type":"response.completed","response":{"id":"resp_1","created_at":1,"model":"gpt-5.2","status":"completed","output":[
+		{"type":"function_call","call_id":"` + short + `","name":"lookup","arguments":"{}"}
+	]}}`)
+	out := ConvertCodexResponseToOpenAINonStream(context.Background(), "gpt-5.2", original, request, response, nil)
+	if got := gjson.Get(out, "choices.0.message.tool_calls.0.id").String(); got != longID {
+		t.Errorf("Expected the original call ID to be restored, got %q", got)
+	}
+
+	response = []byte(`{"type":"response.completed","response":{"id":"resp_2","created_at":1,"model":"gpt-5.2","status":"completed","output":[
+		{"type":"function_call","call_id":"call_new","name":"lookup","arguments":"{}"}
+	]}}`)
+	out = ConvertCodexResponseToOpenAINonStream(context.Background(), "gpt-5.2", original, request, response, nil)
+	if got := gjson.Get(out, "choices.0.message.tool_calls.0.id").String(); got != "call_new" {
+		t.Errorf("Expected an unshortened call ID to pass through, got %q", got)
+	}
+}
@@ -16,4 +16,5 @@ func init() {
 			NonStream: ConvertCodexResponseToOpenAINonStream,
 		},
 	)
+	translator.RegisterRequestTranslator(OpenAI, Codex, translator.RequestTranslatorFunc(ConvertOpenAIRequestToCodexE))
 }
@@ -0,0 +1,27 @@
+package responses
+
+import "github.com/router-for-me/CLIProxyAPI/v6/internal/translator/codex/common"
+
+// Options tunes how ConvertOpenAIResponsesRequestToCodexWithOptions shapes the Codex request.
+// The zero value reproduces the behavior of ConvertOpenAIResponsesRequestToCodexE.
+type Options struct {
+	// ModelName rewrites the model name (provider prefixes, aliases) before it is forwarded
+	// and used for capability lookups.
+	ModelName common.ModelNameNormalization
+
+	// InstructionsPrefix is prepended to the instructions, for example to replicate the Codex
+	// CLI preamble. Instructions that already start with it are left unchanged.
+	InstructionsPrefix string
+
+	// DefaultReasoningEfforts maps model name prefixes to the reasoning effort used when the
+	// request sets none. The longest matching prefix wins; unlisted models default to medium.
+	DefaultReasoningEfforts map[string]string
+
+	// MaxImageBytes limits the decoded size of inline (data URL) images; zero means no limit.
+	// Larger images are reported as errors unless DropOversizedImages is set.
+	MaxImageBytes int
+
+	// DropOversizedImages removes images over MaxImageBytes, with a warning, instead of
+	// reporting them.
+	DropOversizedImages bool
+}
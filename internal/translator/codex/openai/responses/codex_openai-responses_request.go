@@ -1,48 +1,161 @@
 package responses
 
 import (
+	"bytes"
 	"crypto/sha256"
 	"encoding/hex"
 	"fmt"
+	"strings"
 
+	"github.com/router-for-me/CLIProxyAPI/v6/internal/translator/codex/common"
+	log "github.com/sirupsen/logrus"
 	"github.com/tidwall/gjson"
 	"github.com/tidwall/sjson"
 )
 
-func ConvertOpenAIResponsesRequestToCodex(modelName string, inputRawJSON []byte, _ bool) []byte {
-	rawJSON := inputRawJSON
+// ConvertOpenAIResponsesRequestToCodex adapts an OpenAI Responses API request for the Codex
+// upstream. The request is edited in place: Codex-required fields are forced, unsupported
+// fields are stripped, and input items are normalized.
+func ConvertOpenAIResponsesRequestToCodex(modelName string, inputRawJSON []byte, stream bool) []byte {
+	out, _ := convertOpenAIResponsesRequestToCodex(modelName, inputRawJSON, stream, Options{})
+	return out
+}
+
+// ConvertOpenAIResponsesRequestToCodexE performs the same conversion as
+// ConvertOpenAIResponsesRequestToCodex but reports requests the Codex backend would reject.
+//
+// Returns:
+//   - []byte: The transformed request data, or nil when the request is rejected
+//   - error: A descriptive error for the first problem found
+func ConvertOpenAIResponsesRequestToCodexE(modelName string, inputRawJSON []byte, stream bool) ([]byte, error) {
+	return ConvertOpenAIResponsesRequestToCodexWithOptions(modelName, inputRawJSON, stream, Options{})
+}
+
+// ConvertOpenAIResponsesRequestToCodexWithOptions performs the same conversion as
+// ConvertOpenAIResponsesRequestToCodexE while honoring the behavior switches in opts.
+func ConvertOpenAIResponsesRequestToCodexWithOptions(modelName string, inputRawJSON []byte, stream bool, opts Options) ([]byte, error) {
+	out, err := convertOpenAIResponsesRequestToCodex(modelName, inputRawJSON, stream, opts)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// convertOpenAIResponsesRequestToCodex adapts the request, repairing what it can and reporting
+// the first problem the strict variant should surface.
+func convertOpenAIResponsesRequestToCodex(modelName string, inputRawJSON []byte, _ bool, opts Options) ([]byte, error) {
+	// Work on a private copy so the returned slice never shares the caller's backing array,
+	// even on paths that make no edits, and concurrent conversions of one buffer stay safe.
+	rawJSON := bytes.Clone(inputRawJSON)
+	var ed common.JSONEditor
+	var convErr error
+	fail := func(err error) {
+		if convErr == nil && err != nil {
+			convErr = err
+		}
+	}
+	if !gjson.ValidBytes(rawJSON) || !gjson.ParseBytes(rawJSON).IsObject() {
+		return rawJSON, fmt.Errorf("request must be a JSON object")
+	}
+	// Explicit nulls ("tool_choice": null, ...) mean the field is not set.
+	rawJSON = common.DropNullFields(rawJSON)
+
+	modelName = common.NormalizeModelName(modelName, opts.ModelName)
+	if model := gjson.GetBytes(rawJSON, "model"); model.Type == gjson.String {
+		if normalized := common.NormalizeModelName(model.String(), opts.ModelName); normalized != model.String() {
+			rawJSON = ed.SetBytes(rawJSON, "model", normalized)
+		}
+	}
 
 	inputResult := gjson.GetBytes(rawJSON, "input")
 	if inputResult.Type == gjson.String {
 		input, _ := sjson.Set(`[{"type":"message","role":"user","content":[{"type":"input_text","text":""}]}]`, "0.content.0.text", inputResult.String())
-		rawJSON, _ = sjson.SetRawBytes(rawJSON, "input", []byte(input))
+		rawJSON = ed.SetRawBytes(rawJSON, "input", []byte(input))
+	}
+
+	rawJSON = ed.SetBytes(rawJSON, "stream", true)
+	rawJSON = ed.SetBytes(rawJSON, "store", false)
+	rawJSON = ed.SetBytes(rawJSON, "parallel_tool_calls", true)
+	rawJSON = ed.SetBytes(rawJSON, "include", mergeInclude(gjson.GetBytes(rawJSON, "include"), "reasoning.encrypted_content"))
+	// Older clients send the legacy reasoning.generate_summary alias; Codex only knows summary.
+	if legacySummary := gjson.GetBytes(rawJSON, "reasoning.generate_summary"); legacySummary.Exists() {
+		if !gjson.GetBytes(rawJSON, "reasoning.summary").Exists() {
+			rawJSON = ed.SetRawBytes(rawJSON, "reasoning.summary", []byte(legacySummary.Raw))
+		}
+		rawJSON = ed.DeleteBytes(rawJSON, "reasoning.generate_summary")
+	}
+	// Mirror the chat-completions path, which defaults reasoning effort per model (medium
+	// unless configured otherwise).
+	if effort := gjson.GetBytes(rawJSON, "reasoning.effort"); effort.Type == gjson.Number {
+		// Some clients send the effort as a level from 0 (minimal) to 3 (high).
+		name, ok := common.ReasoningEffortFromLevel(effort.Float())
+		if !ok {
+			fail(fmt.Errorf("reasoning.effort level %s is out of range", effort.Raw))
+			name = common.DefaultReasoningEffort(modelName, opts.DefaultReasoningEfforts)
+		}
+		rawJSON = ed.SetBytes(rawJSON, "reasoning.effort", name)
+	} else if !effort.Exists() || effort.Type == gjson.Null {
+		rawJSON = ed.SetBytes(rawJSON, "reasoning.effort", common.DefaultReasoningEffort(modelName, opts.DefaultReasoningEfforts))
+	}
+	// Codex Responses rejects token limits, sampling parameters, service_tier, user and its
+	// successor safety_identifier, so strip them out before forwarding.
+	for _, field := range common.RejectedFields() {
+		rawJSON = ed.DeleteBytes(rawJSON, field)
+	}
+
+	// Honor the client's truncation strategy; anything Codex does not know is dropped.
+	if truncation := gjson.GetBytes(rawJSON, "truncation"); truncation.Exists() {
+		switch truncation.String() {
+		case "auto", "disabled":
+		default:
+			fail(fmt.Errorf("unsupported truncation strategy %s", truncation.Raw))
+			rawJSON = ed.DeleteBytes(rawJSON, "truncation")
+		}
 	}
 
-	rawJSON, _ = sjson.SetBytes(rawJSON, "stream", true)
-	rawJSON, _ = sjson.SetBytes(rawJSON, "store", false)
-	rawJSON, _ = sjson.SetBytes(rawJSON, "parallel_tool_calls", true)
-	rawJSON, _ = sjson.SetBytes(rawJSON, "include", []string{"reasoning.encrypted_content"})
-	// Codex Responses rejects token limit fields, so strip them out before forwarding.
-	rawJSON, _ = sjson.DeleteBytes(rawJSON, "max_output_tokens")
-	rawJSON, _ = sjson.DeleteBytes(rawJSON, "max_completion_tokens")
-	rawJSON, _ = sjson.DeleteBytes(rawJSON, "temperature")
-	rawJSON, _ = sjson.DeleteBytes(rawJSON, "top_p")
-	rawJSON, _ = sjson.DeleteBytes(rawJSON, "service_tier")
+	// Keep the tool call budget only for backends that honor it.
+	if gjson.GetBytes(rawJSON, "max_tool_calls").Exists() && !common.LookupCapabilities(modelName).MaxToolCalls {
+		rawJSON = ed.DeleteBytes(rawJSON, "max_tool_calls")
+	}
 
-	// Delete the user field as it is not supported by the Codex upstream.
-	rawJSON, _ = sjson.DeleteBytes(rawJSON, "user")
+	// prompt_cache_key is kept: Codex uses it for prompt caching and the executor forwards it as
+	// the session id.
+	if key := gjson.GetBytes(rawJSON, "prompt_cache_key"); key.Exists() && key.Type != gjson.String {
+		rawJSON = ed.DeleteBytes(rawJSON, "prompt_cache_key")
+	}
 
 	// Convert role "system" to "developer" in input array to comply with Codex API requirements.
-	rawJSON = convertSystemRoleToDeveloper(rawJSON)
-	rawJSON = normalizeInputCallIDs(rawJSON)
+	rawJSON = convertSystemRoleToDeveloper(rawJSON, &ed)
+	var err error
+	rawJSON, err = defaultMissingMessageRoles(rawJSON, &ed)
+	fail(err)
+	rawJSON, err = normalizeInstructions(rawJSON, &ed)
+	fail(err)
+	if opts.InstructionsPrefix != "" {
+		instructions := gjson.GetBytes(rawJSON, "instructions").String()
+		rawJSON = ed.SetBytes(rawJSON, "instructions", common.PrefixInstructions(opts.InstructionsPrefix, instructions))
+	}
+	rawJSON = normalizeResponseFormat(rawJSON, &ed)
+	rawJSON = normalizeMessageContent(rawJSON, &ed)
+	rawJSON = normalizeInputCallIDs(rawJSON, &ed)
+	rawJSON = normalizeInputImageURLs(rawJSON, &ed)
+	if opts.MaxImageBytes > 0 {
+		rawJSON, err = limitInputImages(rawJSON, &ed, opts)
+		fail(err)
+	}
 
-	return rawJSON
+	if err := ed.Finish(rawJSON); err != nil {
+		return rawJSON, err
+	}
+	return rawJSON, convErr
 }
 
 // convertSystemRoleToDeveloper traverses the input array and converts any message items
 // with role "system" to role "developer". This is necessary because Codex API does not
-// accept "system" role in the input array.
-func convertSystemRoleToDeveloper(rawJSON []byte) []byte {
+// accept "system" role in the input array. Roles are trimmed and lowercased first so
+// values such as "System" or " user" are recognized and forwarded in canonical form. Items
+// are edited in place, so unrelated fields on them are preserved.
+func convertSystemRoleToDeveloper(rawJSON []byte, ed *common.JSONEditor) []byte {
 	inputResult := gjson.GetBytes(rawJSON, "input")
 	if !inputResult.IsArray() {
 		return rawJSON
@@ -54,15 +167,177 @@ func convertSystemRoleToDeveloper(rawJSON []byte) []byte {
 	// Directly modify role values for items with "system" role
 	for i := 0; i < len(inputArray); i++ {
 		rolePath := fmt.Sprintf("input.%d.role", i)
-		if gjson.GetBytes(result, rolePath).String() == "system" {
-			result, _ = sjson.SetBytes(result, rolePath, "developer")
+		roleResult := gjson.GetBytes(result, rolePath)
+		if roleResult.Type != gjson.String {
+			continue
+		}
+		role := strings.ToLower(strings.TrimSpace(roleResult.String()))
+		if role == "system" {
+			role = "developer"
+		}
+		if role != roleResult.String() {
+			result = ed.SetBytes(result, rolePath, role)
+		}
+	}
+
+	return result
+}
+
+// mergeInclude combines the client-provided include entries with the entries Codex requires,
+// keeping the first occurrence of each value so duplicates from either side collapse to one.
+func mergeInclude(include gjson.Result, required ...string) []string {
+	merged := make([]string, 0, len(required))
+	seen := make(map[string]struct{})
+	add := func(value string) {
+		if value == "" {
+			return
+		}
+		if _, ok := seen[value]; ok {
+			return
+		}
+		seen[value] = struct{}{}
+		merged = append(merged, value)
+	}
+	if include.IsArray() {
+		for _, item := range include.Array() {
+			if item.Type == gjson.String {
+				add(strings.TrimSpace(item.String()))
+			}
+		}
+	}
+	for _, value := range required {
+		add(value)
+	}
+	return merged
+}
+
+// normalizeInstructions keeps a string "instructions" field exactly as sent. Codex applies it ahead
+// of the whole input, so developer messages stay where they are in the input array and their order
+// relative to other turns is preserved. A null value is dropped so the executor default applies;
+// any other type is dropped and reported because Codex only accepts a string.
+func normalizeInstructions(rawJSON []byte, ed *common.JSONEditor) ([]byte, error) {
+	instructions := gjson.GetBytes(rawJSON, "instructions")
+	switch {
+	case !instructions.Exists(), instructions.Type == gjson.String:
+		return rawJSON, nil
+	case instructions.Type == gjson.Null:
+		return ed.DeleteBytes(rawJSON, "instructions"), nil
+	}
+	return ed.DeleteBytes(rawJSON, "instructions"), fmt.Errorf("instructions must be a string")
+}
+
+// normalizeResponseFormat rewrites a Chat Completions style response_format, which some clients
+// send to the Responses endpoint by mistake, into text.format. A json_schema format is flattened
+// the way the Responses API expects. An explicit text.format wins; response_format is removed
+// either way because Codex does not recognize it.
+func normalizeResponseFormat(rawJSON []byte, ed *common.JSONEditor) []byte {
+	rf := gjson.GetBytes(rawJSON, "response_format")
+	if !rf.Exists() {
+		return rawJSON
+	}
+	if rf.IsObject() && !gjson.GetBytes(rawJSON, "text.format").Exists() {
+		switch rf.Get("type").String() {
+		case "text", "json_object":
+			rawJSON = ed.SetBytes(rawJSON, "text.format.type", rf.Get("type").String())
+		case "json_schema":
+			format := `{"type":"json_schema"}`
+			js := rf.Get("json_schema")
+			for _, key := range []string{"name", "description", "strict", "schema"} {
+				if v := js.Get(key); v.Exists() {
+					format, _ = sjson.SetRaw(format, key, v.Raw)
+				}
+			}
+			rawJSON = ed.SetRawBytes(rawJSON, "text.format", []byte(format))
+		}
+	}
+	return ed.DeleteBytes(rawJSON, "response_format")
+}
+
+// defaultMissingMessageRoles assigns role "user" to message items that arrive without a role,
+// which Codex would otherwise reject. The first such item is reported so the strict variant can
+// refuse the request instead of guessing.
+func defaultMissingMessageRoles(rawJSON []byte, ed *common.JSONEditor) ([]byte, error) {
+	inputResult := gjson.GetBytes(rawJSON, "input")
+	if !inputResult.IsArray() {
+		return rawJSON, nil
+	}
+
+	result := rawJSON
+	var firstErr error
+	for i, item := range inputResult.Array() {
+		if item.Get("type").String() != "message" {
+			continue
+		}
+		if role := item.Get("role"); role.Type == gjson.String && strings.TrimSpace(role.String()) != "" {
+			continue
+		}
+		if firstErr == nil {
+			firstErr = fmt.Errorf("input[%d]: message item is missing a role", i)
 		}
+		result = ed.SetBytes(result, fmt.Sprintf("input.%d.role", i), "user")
 	}
+	return result, firstErr
+}
+
+// normalizeMessageContent rewrites Chat Completions conventions that shims mix into Responses
+// input into the canonical form: typeless {role, content} items become message items, string
+// content becomes a single text part, and "text"/"image_url" parts become input_text (or
+// output_text for assistant turns) and input_image parts. Text parts typed for the wrong
+// role are retyped as well.
+func normalizeMessageContent(rawJSON []byte, ed *common.JSONEditor) []byte {
+	inputResult := gjson.GetBytes(rawJSON, "input")
+	if !inputResult.IsArray() {
+		return rawJSON
+	}
+
+	result := rawJSON
+	for i, item := range inputResult.Array() {
+		itemPath := fmt.Sprintf("input.%d", i)
+		if !item.Get("type").Exists() && item.Get("role").Exists() && item.Get("content").Exists() {
+			result = ed.SetBytes(result, itemPath+".type", "message")
+		} else if item.Get("type").String() != "message" {
+			continue
+		}
 
+		textType := "input_text"
+		if item.Get("role").String() == "assistant" {
+			textType = "output_text"
+		}
+		content := item.Get("content")
+		if content.Type == gjson.String {
+			part, _ := sjson.Set(`{"type":""}`, "type", textType)
+			part, _ = sjson.Set(part, "text", content.String())
+			result = ed.SetRawBytes(result, itemPath+".content", []byte("["+part+"]"))
+			continue
+		}
+		if !content.IsArray() {
+			continue
+		}
+		for j, part := range content.Array() {
+			partPath := fmt.Sprintf("%s.content.%d", itemPath, j)
+			switch partType := part.Get("type").String(); partType {
+			case "text", "input_text", "output_text":
+				// Replayed turns must use output_text for assistant content and input_text
+				// for everything else, regardless of how the client typed them. Only the type
+				// is rewritten, so annotations (citations) on the part are kept.
+				if partType != textType {
+					result = ed.SetBytes(result, partPath+".type", textType)
+				}
+			case "image_url":
+				// The object form of image_url is flattened by normalizeInputImageURLs.
+				result = ed.SetBytes(result, partPath+".type", "input_image")
+			}
+		}
+	}
 	return result
 }
 
-func normalizeInputCallIDs(rawJSON []byte) []byte {
+// normalizeInputCallIDs shortens call IDs, including image_generation_call item ids, that exceed
+// the Codex limit and synthesizes IDs for
+// function_call items sent with an empty call_id. Outputs with an empty call_id are paired with
+// the pending synthesized IDs in order, mirroring how the calls were issued. Only the id fields
+// are rewritten; other item fields, including vendor extensions, pass through untouched.
+func normalizeInputCallIDs(rawJSON []byte, ed *common.JSONEditor) []byte {
 	inputResult := gjson.GetBytes(rawJSON, "input")
 	if !inputResult.IsArray() {
 		return rawJSON
@@ -70,9 +345,35 @@ func normalizeInputCallIDs(rawJSON []byte) []byte {
 
 	result := rawJSON
 	callIDMap := map[string]string{}
+	imageIDMap := map[string]string{}
+	var pendingSynthesized []string
 	for i, item := range inputResult.Array() {
+		// Image generation items are identified by their item id; it is subject to the same
+		// length limit and is referenced by later turns, so shorten it consistently too.
+		if item.Get("type").String() == "image_generation_call" {
+			if id := item.Get("id").String(); id != "" {
+				if normalized := normalizeImageGenerationID(id, imageIDMap); normalized != id {
+					result = ed.SetBytes(result, fmt.Sprintf("input.%d.id", i), normalized)
+				}
+			}
+		}
 		callID := item.Get("call_id").String()
 		if callID == "" {
+			var synthesized string
+			switch item.Get("type").String() {
+			case "function_call":
+				synthesized = synthesizeCallID(i, item.Get("name").String(), item.Get("arguments").String())
+				pendingSynthesized = append(pendingSynthesized, synthesized)
+			case "function_call_output":
+				if len(pendingSynthesized) == 0 {
+					continue
+				}
+				synthesized = pendingSynthesized[0]
+				pendingSynthesized = pendingSynthesized[1:]
+			default:
+				continue
+			}
+			result = ed.SetBytes(result, fmt.Sprintf("input.%d.call_id", i), synthesized)
 			continue
 		}
 		normalized := normalizeCallID(callID, callIDMap)
@@ -80,12 +381,30 @@ func normalizeInputCallIDs(rawJSON []byte) []byte {
 			continue
 		}
 		path := fmt.Sprintf("input.%d.call_id", i)
-		result, _ = sjson.SetBytes(result, path, normalized)
+		result = ed.SetBytes(result, path, normalized)
 	}
 	return result
 }
 
+// synthesizeCallID derives a stable call ID from the item position, tool name and arguments.
+func synthesizeCallID(index int, name, arguments string) string {
+	sum := sha256.Sum256([]byte(fmt.Sprintf("%d\x00%s\x00%s", index, name, arguments)))
+	return "call_" + hex.EncodeToString(sum[:])[:24]
+}
+
 func normalizeCallID(id string, cache map[string]string) string {
+	return shortenID(id, "call_", cache)
+}
+
+// normalizeImageGenerationID shortens an over-long image_generation_call item id while keeping
+// its "ig_" prefix, matching the ids the chat-completions translator generates.
+func normalizeImageGenerationID(id string, cache map[string]string) string {
+	return shortenID(id, "ig_", cache)
+}
+
+// shortenID replaces an id longer than the Codex limit with prefix plus a hash of the id.
+// Results are memoized in cache, when given, so repeated ids map to the same value.
+func shortenID(id, prefix string, cache map[string]string) string {
 	const limit = 64
 	if id == "" || len(id) <= limit {
 		return id
@@ -97,7 +416,6 @@ func normalizeCallID(id string, cache map[string]string) string {
 	}
 	sum := sha256.Sum256([]byte(id))
 	hash := hex.EncodeToString(sum[:])
-	prefix := "call_"
 	available := limit - len(prefix)
 	if available < 0 {
 		available = 0
@@ -111,3 +429,74 @@ func normalizeCallID(id string, cache map[string]string) string {
 	}
 	return short
 }
+
+// limitInputImages enforces opts.MaxImageBytes on inline (data URL) input_image parts of message
+// content and of function_call_output item arrays. Oversized images are removed when
+// opts.DropOversizedImages is set; otherwise they are kept and the first one is reported.
+func limitInputImages(rawJSON []byte, ed *common.JSONEditor, opts Options) ([]byte, error) {
+	inputResult := gjson.GetBytes(rawJSON, "input")
+	if !inputResult.IsArray() {
+		return rawJSON, nil
+	}
+
+	result := rawJSON
+	var firstErr error
+	items := inputResult.Array()
+	for i := len(items) - 1; i >= 0; i-- {
+		field := "content"
+		if items[i].Get("type").String() == "function_call_output" {
+			field = "output"
+		}
+		parts := items[i].Get(field).Array()
+		// Walk backwards so deleting a part does not shift the ones still to be checked.
+		for j := len(parts) - 1; j >= 0; j-- {
+			if parts[j].Get("type").String() != "input_image" {
+				continue
+			}
+			size, ok := common.DataURLSize(parts[j].Get("image_url").String())
+			if !ok || size <= opts.MaxImageBytes {
+				continue
+			}
+			if opts.DropOversizedImages {
+				log.Warnf("codex translator: dropping %d byte image in input %d", size, i)
+				result = ed.DeleteBytes(result, fmt.Sprintf("input.%d.%s.%d", i, field, j))
+				continue
+			}
+			firstErr = fmt.Errorf("input[%d].%s[%d]: image is %d bytes, more than the limit of %d", i, field, j, size, opts.MaxImageBytes)
+		}
+	}
+	return result, firstErr
+}
+
+// normalizeInputImageURLs flattens Chat Completions style image_url objects ({"url":"..."})
+// on input_image parts into the plain string form the Codex API expects. A "detail" carried
+// inside the object is lifted onto the part unless the part already specifies one.
+func normalizeInputImageURLs(rawJSON []byte, ed *common.JSONEditor) []byte {
+	inputResult := gjson.GetBytes(rawJSON, "input")
+	if !inputResult.IsArray() {
+		return rawJSON
+	}
+
+	result := rawJSON
+	for i, item := range inputResult.Array() {
+		content := item.Get("content")
+		if !content.IsArray() {
+			continue
+		}
+		for j, part := range content.Array() {
+			if part.Get("type").String() != "input_image" {
+				continue
+			}
+			imageURL := part.Get("image_url")
+			if !imageURL.IsObject() {
+				continue
+			}
+			partPath := fmt.Sprintf("input.%d.content.%d", i, j)
+			result = ed.SetBytes(result, partPath+".image_url", imageURL.Get("url").String())
+			if detail := imageURL.Get("detail"); detail.Exists() && !part.Get("detail").Exists() {
+				result = ed.SetBytes(result, partPath+".detail", detail.String())
+			}
+		}
+	}
+	return result
+}
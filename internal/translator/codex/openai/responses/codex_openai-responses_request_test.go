@@ -1,11 +1,17 @@
 package responses
 
 import (
+	"encoding/json"
 	"fmt"
+	"reflect"
 	"strings"
+	"sync"
 	"testing"
 
+	"github.com/router-for-me/CLIProxyAPI/v6/internal/translator/codex/common"
+	chatcompletions "github.com/router-for-me/CLIProxyAPI/v6/internal/translator/codex/openai/chat-completions"
 	"github.com/tidwall/gjson"
+	"github.com/tidwall/sjson"
 )
 
 // TestConvertSystemRoleToDeveloper_BasicConversion tests the basic system -> developer role conversion
@@ -283,6 +289,34 @@ func TestUserFieldDeletion(t *testing.T) {
 	}
 }
 
+// TestSafetyIdentifierDeletion tests that safety_identifier is stripped like user
+func TestSafetyIdentifierDeletion(t *testing.T) {
+	inputJSON := []byte(`{"model":"gpt-5.2","safety_identifier":"hashed-user-id","input":"Hello"}`)
+
+	output := ConvertOpenAIResponsesRequestToCodex("gpt-5.2", inputJSON, false)
+
+	if field := gjson.GetBytes(output, "safety_identifier"); field.Exists() {
+		t.Errorf("safety_identifier field should be deleted, but it was found with value: %s", field.Raw)
+	}
+}
+
+// TestPromptCacheKeyForwarded tests that prompt_cache_key is kept for Codex prompt caching and
+// dropped when it is not a string
+func TestPromptCacheKeyForwarded(t *testing.T) {
+	inputJSON := []byte(`{"model":"gpt-5.2","prompt_cache_key":"session-42","input":"Hello"}`)
+
+	output := ConvertOpenAIResponsesRequestToCodex("gpt-5.2", inputJSON, false)
+	if got := gjson.GetBytes(output, "prompt_cache_key").String(); got != "session-42" {
+		t.Errorf("Expected prompt_cache_key 'session-42', got %q", got)
+	}
+
+	invalid := []byte(`{"model":"gpt-5.2","prompt_cache_key":{"id":1},"input":"Hello"}`)
+	output = ConvertOpenAIResponsesRequestToCodex("gpt-5.2", invalid, false)
+	if field := gjson.GetBytes(output, "prompt_cache_key"); field.Exists() {
+		t.Errorf("Expected non-string prompt_cache_key to be dropped, got %s", field.Raw)
+	}
+}
+
 func TestConvertOpenAIResponsesRequestToCodex_CallIDShortening(t *testing.T) {
 	longID := strings.Repeat("a", 80)
 	inputJSON := []byte(fmt.Sprintf(`{
@@ -307,3 +341,719 @@ func TestConvertOpenAIResponsesRequestToCodex_CallIDShortening(t *testing.T) {
 		t.Fatalf("call_id should be shortened, got original id")
 	}
 }
+
+// TestConvertOpenAIResponsesRequestToCodex_ImageGenerationCallIDShortening tests that long ids on
+// image_generation_call items are shortened like function call ids
+func TestConvertOpenAIResponsesRequestToCodex_ImageGenerationCallIDShortening(t *testing.T) {
+	longID := "ig_" + strings.Repeat("b", 80)
+	longCallID := "call_" + strings.Repeat("c", 80)
+	inputJSON := []byte(fmt.Sprintf(`{
+		"model": "gpt-5.2",
+		"input": [
+			{"type": "message", "role": "user", "content": [{"type": "input_text", "text": "Draw a cat"}]},
+			{"type": "image_generation_call", "id": "%s", "call_id": "%s", "status": "completed", "result": "aGVsbG8="}
+		]
+	}`, longID, longCallID))
+
+	output := ConvertOpenAIResponsesRequestToCodex("gpt-5.2", inputJSON, false)
+
+	outID := gjson.GetBytes(output, "input.1.id").String()
+	if len(outID) > 64 || outID == longID || !strings.HasPrefix(outID, "ig_") {
+		t.Errorf("Expected image_generation_call id to be shortened with its ig_ prefix, got %q", outID)
+	}
+	outCallID := gjson.GetBytes(output, "input.1.call_id").String()
+	if len(outCallID) > 64 || outCallID == longCallID {
+		t.Errorf("Expected image_generation_call call_id to be shortened, got %q", outCallID)
+	}
+	if got := gjson.GetBytes(output, "input.1.result").String(); got != "aGVsbG8=" {
+		t.Errorf("Expected result to be preserved, got %q", got)
+	}
+
+	again := ConvertOpenAIResponsesRequestToCodex("gpt-5.2", inputJSON, false)
+	if got := gjson.GetBytes(again, "input.1.id").String(); got != outID {
+		t.Errorf("Expected shortened id to be stable, got %q then %q", outID, got)
+	}
+}
+
+// TestConvertOpenAIResponsesRequestToCodex_ObjectImageURLFlattened tests that object-form
+// image_url values on input_image parts are flattened to the string form
+func TestConvertOpenAIResponsesRequestToCodex_ObjectImageURLFlattened(t *testing.T) {
+	inputJSON := []byte(`{
+		"model": "gpt-5.2",
+		"input": [
+			{
+				"type": "message",
+				"role": "user",
+				"content": [
+					{"type": "input_text", "text": "What is in this image?"},
+					{"type": "input_image", "image_url": {"url": "https://example.com/cat.png", "detail": "high"}},
+					{"type": "input_image", "image_url": "https://example.com/dog.png"}
+				]
+			}
+		]
+	}`)
+
+	output := ConvertOpenAIResponsesRequestToCodex("gpt-5.2", inputJSON, false)
+
+	first := gjson.GetBytes(output, "input.0.content.1")
+	if first.Get("image_url").Type != gjson.String {
+		t.Fatalf("Expected image_url to be a string, got %s", first.Get("image_url").Raw)
+	}
+	if first.Get("image_url").String() != "https://example.com/cat.png" {
+		t.Errorf("Expected flattened url, got %s", first.Get("image_url").String())
+	}
+	if first.Get("detail").String() != "high" {
+		t.Errorf("Expected detail 'high' to be lifted onto the part, got %s", first.Get("detail").Raw)
+	}
+
+	second := gjson.GetBytes(output, "input.0.content.2.image_url")
+	if second.String() != "https://example.com/dog.png" {
+		t.Errorf("Expected string image_url to be untouched, got %s", second.Raw)
+	}
+}
+
+// TestConvertSystemRoleToDeveloper_MixedCaseAndPaddedRoles tests that roles are trimmed and
+// lowercased before the system check
+func TestConvertSystemRoleToDeveloper_MixedCaseAndPaddedRoles(t *testing.T) {
+	inputJSON := []byte(`{
+		"model": "gpt-5.2",
+		"input": [
+			{"type": "message", "role": "System", "content": [{"type": "input_text", "text": "Be brief."}]},
+			{"type": "message", "role": " user ", "content": [{"type": "input_text", "text": "Hello"}]},
+			{"type": "message", "role": "ASSISTANT", "content": [{"type": "output_text", "text": "Hi"}]}
+		]
+	}`)
+
+	output := ConvertOpenAIResponsesRequestToCodex("gpt-5.2", inputJSON, false)
+
+	expected := []string{"developer", "user", "assistant"}
+	for i, want := range expected {
+		if got := gjson.GetBytes(output, fmt.Sprintf("input.%d.role", i)).String(); got != want {
+			t.Errorf("Expected role %q at index %d, got %q", want, i, got)
+		}
+	}
+}
+
+// TestConvertOpenAIResponsesRequestToCodex_DefaultReasoningEffortParity tests that the responses
+// path defaults reasoning effort the same way the chat-completions path does
+func TestConvertOpenAIResponsesRequestToCodex_DefaultReasoningEffortParity(t *testing.T) {
+	chatJSON := []byte(`{"model":"gpt-5.2","messages":[{"role":"user","content":"Hello"}]}`)
+	responsesJSON := []byte(`{"model":"gpt-5.2","input":"Hello"}`)
+
+	chatEffort := gjson.GetBytes(chatcompletions.ConvertOpenAIRequestToCodex("gpt-5.2", chatJSON, true), "reasoning.effort").String()
+	responsesEffort := gjson.GetBytes(ConvertOpenAIResponsesRequestToCodex("gpt-5.2", responsesJSON, true), "reasoning.effort").String()
+
+	if chatEffort != "medium" {
+		t.Errorf("Expected chat default effort 'medium', got %q", chatEffort)
+	}
+	if responsesEffort != chatEffort {
+		t.Errorf("Expected responses default effort %q to match chat, got %q", chatEffort, responsesEffort)
+	}
+
+	explicit := []byte(`{"model":"gpt-5.2","input":"Hello","reasoning":{"effort":"high"}}`)
+	if got := gjson.GetBytes(ConvertOpenAIResponsesRequestToCodex("gpt-5.2", explicit, true), "reasoning.effort").String(); got != "high" {
+		t.Errorf("Expected explicit effort 'high' to be preserved, got %q", got)
+	}
+}
+
+// TestConvertOpenAIResponsesRequestToCodex_EmptyCallIDSynthesized tests that an empty call_id on a
+// function_call is replaced and its output receives the same id
+func TestConvertOpenAIResponsesRequestToCodex_EmptyCallIDSynthesized(t *testing.T) {
+	inputJSON := []byte(`{
+		"model": "gpt-5.2",
+		"input": [
+			{"type": "message", "role": "user", "content": [{"type": "input_text", "text": "Weather?"}]},
+			{"type": "function_call", "call_id": "", "name": "get_weather", "arguments": "{\"city\":\"Paris\"}"},
+			{"type": "function_call_output", "call_id": "", "output": "sunny"}
+		]
+	}`)
+
+	output := ConvertOpenAIResponsesRequestToCodex("gpt-5.2", inputJSON, false)
+
+	callID := gjson.GetBytes(output, "input.1.call_id").String()
+	if callID == "" {
+		t.Fatal("Expected a synthesized call_id on the function_call")
+	}
+	if !strings.HasPrefix(callID, "call_") {
+		t.Errorf("Expected synthesized call_id to start with call_, got %q", callID)
+	}
+	if got := gjson.GetBytes(output, "input.2.call_id").String(); got != callID {
+		t.Errorf("Expected function_call_output call_id %q, got %q", callID, got)
+	}
+
+	again := ConvertOpenAIResponsesRequestToCodex("gpt-5.2", inputJSON, false)
+	if got := gjson.GetBytes(again, "input.1.call_id").String(); got != callID {
+		t.Errorf("Expected synthesized call_id to be stable, got %q then %q", callID, got)
+	}
+}
+
+// TestConvertOpenAIResponsesRequestToCodex_MissingMessageRole tests that a message item without a
+// role defaults to user, while the strict variant rejects it
+func TestConvertOpenAIResponsesRequestToCodex_MissingMessageRole(t *testing.T) {
+	inputJSON := []byte(`{
+		"model": "gpt-5.2",
+		"input": [
+			{"type": "message", "role": "system", "content": [{"type": "input_text", "text": "Be brief."}]},
+			{"type": "message", "content": [{"type": "input_text", "text": "Hello"}]}
+		]
+	}`)
+
+	output := ConvertOpenAIResponsesRequestToCodex("gpt-5.2", append([]byte(nil), inputJSON...), false)
+	if got := gjson.GetBytes(output, "input.1.role").String(); got != "user" {
+		t.Errorf("Expected role-less message to default to 'user', got %q", got)
+	}
+	if got := gjson.GetBytes(output, "input.0.role").String(); got != "developer" {
+		t.Errorf("Expected existing role to be kept as 'developer', got %q", got)
+	}
+
+	strict, err := ConvertOpenAIResponsesRequestToCodexE("gpt-5.2", append([]byte(nil), inputJSON...), false)
+	if err == nil {
+		t.Fatal("Expected strict conversion to reject a role-less message, got nil error")
+	}
+	if !strings.Contains(err.Error(), "input[1]") {
+		t.Errorf("Expected error to reference input[1], got: %v", err)
+	}
+	if strict != nil {
+		t.Errorf("Expected nil output on strict rejection, got %s", string(strict))
+	}
+}
+
+// TestConvertOpenAIResponsesRequestToCodex_LegacyGenerateSummary tests that the legacy
+// reasoning.generate_summary alias is forwarded as reasoning.summary
+func TestConvertOpenAIResponsesRequestToCodex_LegacyGenerateSummary(t *testing.T) {
+	inputJSON := []byte(`{"model":"gpt-5.2","input":"Hello","reasoning":{"effort":"low","generate_summary":"concise"}}`)
+
+	output := ConvertOpenAIResponsesRequestToCodex("gpt-5.2", inputJSON, false)
+
+	if got := gjson.GetBytes(output, "reasoning.summary").String(); got != "concise" {
+		t.Errorf("Expected reasoning.summary 'concise', got %q", got)
+	}
+	if gjson.GetBytes(output, "reasoning.generate_summary").Exists() {
+		t.Error("Expected reasoning.generate_summary to be removed")
+	}
+	if got := gjson.GetBytes(output, "reasoning.effort").String(); got != "low" {
+		t.Errorf("Expected reasoning.effort 'low' to be preserved, got %q", got)
+	}
+
+	both := []byte(`{"model":"gpt-5.2","input":"Hello","reasoning":{"summary":"detailed","generate_summary":"concise"}}`)
+	output = ConvertOpenAIResponsesRequestToCodex("gpt-5.2", both, false)
+	if got := gjson.GetBytes(output, "reasoning.summary").String(); got != "detailed" {
+		t.Errorf("Expected explicit reasoning.summary to win, got %q", got)
+	}
+}
+
+// TestConvertOpenAIResponsesRequestToCodex_InstructionsWithDeveloperMessages tests that an incoming
+// instructions string is forwarded unchanged and developer messages keep their place in the input
+func TestConvertOpenAIResponsesRequestToCodex_InstructionsWithDeveloperMessages(t *testing.T) {
+	instructions := "You are a helpful assistant.\n\nAnswer in French."
+	inputJSON := []byte(`{
+		"model": "gpt-5.2",
+		"instructions": "You are a helpful assistant.\n\nAnswer in French.",
+		"input": [
+			{"type": "message", "role": "developer", "content": [{"type": "input_text", "text": "Be brief."}]},
+			{"type": "message", "role": "user", "content": [{"type": "input_text", "text": "Hello"}]},
+			{"type": "message", "role": "system", "content": [{"type": "input_text", "text": "Use formal tone."}]}
+		]
+	}`)
+
+	output, err := ConvertOpenAIResponsesRequestToCodexE("gpt-5.2", inputJSON, false)
+	if err != nil {
+		t.Fatalf("Expected no error, got: %v", err)
+	}
+
+	if got := gjson.GetBytes(output, "instructions").String(); got != instructions {
+		t.Errorf("Expected instructions %q to be forwarded unchanged, got %q", instructions, got)
+	}
+	expected := []struct{ role, text string }{
+		{"developer", "Be brief."},
+		{"user", "Hello"},
+		{"developer", "Use formal tone."},
+	}
+	input := gjson.GetBytes(output, "input").Array()
+	if len(input) != len(expected) {
+		t.Fatalf("Expected %d input items, got %d", len(expected), len(input))
+	}
+	for i, want := range expected {
+		if got := input[i].Get("role").String(); got != want.role {
+			t.Errorf("Expected input[%d] role %q, got %q", i, want.role, got)
+		}
+		if got := input[i].Get("content.0.text").String(); got != want.text {
+			t.Errorf("Expected input[%d] text %q, got %q", i, want.text, got)
+		}
+	}
+
+	nullJSON := []byte(`{"model":"gpt-5.2","instructions":null,"input":"Hello"}`)
+	output = ConvertOpenAIResponsesRequestToCodex("gpt-5.2", nullJSON, false)
+	if gjson.GetBytes(output, "instructions").Exists() {
+		t.Error("Expected null instructions to be dropped")
+	}
+
+	badJSON := []byte(`{"model":"gpt-5.2","instructions":["a"],"input":"Hello"}`)
+	if _, err = ConvertOpenAIResponsesRequestToCodexE("gpt-5.2", badJSON, false); err == nil {
+		t.Error("Expected non-string instructions to be rejected by the strict variant")
+	}
+}
+
+// TestConvertOpenAIResponsesRequestToCodex_DuplicateIncludes tests that client-provided include
+// entries are merged with the required ones without duplicates
+func TestConvertOpenAIResponsesRequestToCodex_DuplicateIncludes(t *testing.T) {
+	inputJSON := []byte(`{"model":"gpt-5.2","input":"Hello","include":["reasoning.encrypted_content","reasoning.encrypted_content"]}`)
+
+	output := ConvertOpenAIResponsesRequestToCodex("gpt-5.2", inputJSON, false)
+	if got := gjson.GetBytes(output, "include").Raw; got != `["reasoning.encrypted_content"]` {
+		t.Errorf("Expected duplicated includes to collapse to one entry, got %s", got)
+	}
+
+	inputJSON = []byte(`{"model":"gpt-5.2","input":"Hello","include":["message.output_text.logprobs","message.output_text.logprobs"]}`)
+	output = ConvertOpenAIResponsesRequestToCodex("gpt-5.2", inputJSON, false)
+	if got := gjson.GetBytes(output, "include").Raw; got != `["message.output_text.logprobs","reasoning.encrypted_content"]` {
+		t.Errorf("Expected client includes to be merged with the required entry, got %s", got)
+	}
+}
+
+// TestConvertOpenAIResponsesRequestToCodex_MaxToolCalls tests that max_tool_calls survives for
+// models that honor a tool call budget and is stripped otherwise
+func TestConvertOpenAIResponsesRequestToCodex_MaxToolCalls(t *testing.T) {
+	inputJSON := []byte(`{"model":"gpt-5.2","input":"Hello","max_tool_calls":3}`)
+
+	output := ConvertOpenAIResponsesRequestToCodex("gpt-5.2", append([]byte(nil), inputJSON...), false)
+	if got := gjson.GetBytes(output, "max_tool_calls"); got.Int() != 3 {
+		t.Errorf("Expected max_tool_calls 3, got %s", got.Raw)
+	}
+
+	output = ConvertOpenAIResponsesRequestToCodex("gpt-audio", append([]byte(nil), inputJSON...), false)
+	if gjson.GetBytes(output, "max_tool_calls").Exists() {
+		t.Error("Expected max_tool_calls to be dropped for a model without support")
+	}
+}
+
+// TestConvertOpenAIResponsesRequestToCodex_Truncation tests that a valid truncation strategy is
+// forwarded and an unknown one is dropped and reported by the strict variant
+func TestConvertOpenAIResponsesRequestToCodex_Truncation(t *testing.T) {
+	inputJSON := []byte(`{"model":"gpt-5.2","input":"Hello","truncation":"auto"}`)
+	output, err := ConvertOpenAIResponsesRequestToCodexE("gpt-5.2", inputJSON, false)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if got := gjson.GetBytes(output, "truncation").String(); got != "auto" {
+		t.Errorf("Expected truncation 'auto', got %q", got)
+	}
+
+	badJSON := []byte(`{"model":"gpt-5.2","input":"Hello","truncation":"oldest"}`)
+	output = ConvertOpenAIResponsesRequestToCodex("gpt-5.2", append([]byte(nil), badJSON...), false)
+	if gjson.GetBytes(output, "truncation").Exists() {
+		t.Error("Expected unknown truncation strategy to be dropped")
+	}
+	if _, err = ConvertOpenAIResponsesRequestToCodexE("gpt-5.2", badJSON, false); err == nil {
+		t.Error("Expected strict conversion to reject an unknown truncation strategy")
+	}
+}
+
+// TestConvertOpenAIResponsesRequestToCodex_ModelNameNormalization tests that the model field is
+// rewritten for a prefixed alias and left alone for a direct name
+func TestConvertOpenAIResponsesRequestToCodex_ModelNameNormalization(t *testing.T) {
+	opts := Options{ModelName: common.ModelNameNormalization{
+		StripProviderPrefix: true,
+		Aliases:             map[string]string{"gpt-latest": "gpt-5.2"},
+	}}
+
+	prefixed := []byte(`{"model":"openai/gpt-latest","input":"Hello"}`)
+	output, err := ConvertOpenAIResponsesRequestToCodexWithOptions("openai/gpt-latest", prefixed, false, opts)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if got := gjson.GetBytes(output, "model").String(); got != "gpt-5.2" {
+		t.Errorf("Expected prefixed alias to map to 'gpt-5.2', got %q", got)
+	}
+
+	direct := []byte(`{"model":"gpt-5.2-codex","input":"Hello"}`)
+	output, _ = ConvertOpenAIResponsesRequestToCodexWithOptions("gpt-5.2-codex", direct, false, opts)
+	if got := gjson.GetBytes(output, "model").String(); got != "gpt-5.2-codex" {
+		t.Errorf("Expected direct name to be kept, got %q", got)
+	}
+}
+
+// TestConvertOpenAIResponsesRequestToCodex_DoesNotAliasInput tests that the caller's buffer is
+// never modified, including when it is shared by concurrent conversions
+func TestConvertOpenAIResponsesRequestToCodex_DoesNotAliasInput(t *testing.T) {
+	original := `{"model":"gpt-5.2","input":[{"type":"message","role":"system","content":[{"type":"input_text","text":"Be brief."}]}],"user":"u","temperature":0.2}`
+	inputJSON := []byte(original)
+
+	var wg sync.WaitGroup
+	outputs := make([][]byte, 8)
+	for i := range outputs {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			outputs[i] = ConvertOpenAIResponsesRequestToCodex("gpt-5.2", inputJSON, false)
+		}(i)
+	}
+	wg.Wait()
+
+	if string(inputJSON) != original {
+		t.Fatalf("Expected input buffer to be unchanged, got %s", inputJSON)
+	}
+	for i, out := range outputs {
+		if string(out) != string(outputs[0]) {
+			t.Errorf("Expected identical outputs, output %d differs: %s", i, out)
+		}
+		if got := gjson.GetBytes(out, "input.0.role").String(); got != "developer" {
+			t.Errorf("Expected output %d role 'developer', got %q", i, got)
+		}
+	}
+
+	// Rejected requests are returned unedited; the result must still be a separate buffer.
+	invalid := []byte(`["not an object"]`)
+	out := ConvertOpenAIResponsesRequestToCodex("gpt-5.2", invalid, false)
+	out[0] = '{'
+	if string(invalid) != `["not an object"]` {
+		t.Errorf("Expected returned buffer not to alias the input, input is now %s", invalid)
+	}
+}
+
+// TestConvertOpenAIResponsesRequestToCodex_MixedConventionInput tests that Chat Completions style
+// items and parts mixed into the input are normalized to the canonical Responses form
+func TestConvertOpenAIResponsesRequestToCodex_MixedConventionInput(t *testing.T) {
+	inputJSON := []byte(`{
+		"model": "gpt-5.2",
+		"input": [
+			{"role": "system", "content": "Be brief."},
+			{"type": "message", "role": "user", "content": [
+				{"type": "text", "text": "What is this?"},
+				{"type": "image_url", "image_url": {"url": "https://example.com/cat.png"}}
+			]},
+			{"role": "assistant", "content": "A cat."},
+			{"type": "message", "role": "user", "content": [{"type": "input_text", "text": "Thanks"}]}
+		]
+	}`)
+
+	output := ConvertOpenAIResponsesRequestToCodex("gpt-5.2", inputJSON, false)
+
+	expected := `[
+		{"role":"developer","content":[{"type":"input_text","text":"Be brief."}],"type":"message"},
+		{"type":"message","role":"user","content":[{"type":"input_text","text":"What is this?"},{"type":"input_image","image_url":"https://example.com/cat.png"}]},
+		{"role":"assistant","content":[{"type":"output_text","text":"A cat."}],"type":"message"},
+		{"type":"message","role":"user","content":[{"type":"input_text","text":"Thanks"}]}
+	]`
+	if got := gjson.GetBytes(output, "input"); !jsonEqualForTest(got.Raw, expected) {
+		t.Errorf("Expected normalized input\n%s\ngot\n%s", expected, got.Raw)
+	}
+}
+
+// TestConvertOpenAIResponsesRequestToCodex_ReplayedTurnPartTypes tests that replayed assistant
+// content uses output_text and developer content uses input_text
+func TestConvertOpenAIResponsesRequestToCodex_ReplayedTurnPartTypes(t *testing.T) {
+	inputJSON := []byte(`{
+		"model": "gpt-5.2",
+		"input": [
+			{"type": "message", "role": "system", "content": [{"type": "output_text", "text": "Be brief."}]},
+			{"type": "message", "role": "user", "content": [{"type": "input_text", "text": "Hi"}]},
+			{"type": "message", "role": "assistant", "content": [{"type": "input_text", "text": "Hello!"}, {"type": "output_text", "text": "How can I help?"}]}
+		]
+	}`)
+
+	output := ConvertOpenAIResponsesRequestToCodex("gpt-5.2", inputJSON, false)
+
+	checks := map[string]string{
+		"input.0.role":           "developer",
+		"input.0.content.0.type": "input_text",
+		"input.1.content.0.type": "input_text",
+		"input.2.content.0.type": "output_text",
+		"input.2.content.1.type": "output_text",
+		"input.2.content.0.text": "Hello!",
+	}
+	for path, want := range checks {
+		if got := gjson.GetBytes(output, path).String(); got != want {
+			t.Errorf("Expected %s %q, got %q", path, want, got)
+		}
+	}
+}
+
+// TestConvertOpenAIResponsesRequestToCodex_VendorFieldsSurvive tests that unknown fields on input
+// items are preserved while roles and call IDs are normalized
+func TestConvertOpenAIResponsesRequestToCodex_VendorFieldsSurvive(t *testing.T) {
+	longID := strings.Repeat("d", 80)
+	inputJSON := []byte(fmt.Sprintf(`{
+		"model": "gpt-5.2",
+		"input": [
+			{"type": "message", "role": "System", "content": [{"type": "input_text", "text": "Be brief."}], "providerData": {"trace": "abc"}},
+			{"type": "function_call", "call_id": "%s", "name": "lookup", "arguments": "{}", "providerData": {"latency_ms": 12}},
+			{"type": "function_call_output", "call_id": "%s", "output": "ok", "x-vendor": "kept"}
+		]
+	}`, longID, longID))
+
+	output := ConvertOpenAIResponsesRequestToCodex("gpt-5.2", inputJSON, false)
+
+	if got := gjson.GetBytes(output, "input.0.role").String(); got != "developer" {
+		t.Errorf("Expected role to be normalized to developer, got %q", got)
+	}
+	if got := gjson.GetBytes(output, "input.0.providerData.trace").String(); got != "abc" {
+		t.Errorf("Expected providerData on the message to survive, got %s", gjson.GetBytes(output, "input.0").Raw)
+	}
+	if got := gjson.GetBytes(output, "input.1.call_id").String(); got == longID {
+		t.Error("Expected the long call_id to be shortened")
+	}
+	if got := gjson.GetBytes(output, "input.1.providerData.latency_ms").Int(); got != 12 {
+		t.Errorf("Expected providerData on the function_call to survive, got %s", gjson.GetBytes(output, "input.1").Raw)
+	}
+	if got := gjson.GetBytes(output, "input.2.x-vendor").String(); got != "kept" {
+		t.Errorf("Expected vendor field on the output to survive, got %s", gjson.GetBytes(output, "input.2").Raw)
+	}
+}
+
+// TestConvertOpenAIResponsesRequestToCodex_ReplayedReasoningItem tests that a replayed reasoning
+// item with encrypted_content is forwarded intact and in place
+func TestConvertOpenAIResponsesRequestToCodex_ReplayedReasoningItem(t *testing.T) {
+	reasoning := `{"type":"reasoning","id":"rs_123","summary":[{"type":"summary_text","text":"Thinking about weather"}],"encrypted_content":"gAAAAABo-encrypted=="}`
+	inputJSON := []byte(`{
+		"model": "gpt-5.2",
+		"input": [
+			{"type": "message", "role": "user", "content": [{"type": "input_text", "text": "Weather?"}]},
+			` + reasoning + `,
+			{"type": "function_call", "call_id": "call_1", "name": "get_weather", "arguments": "{}"},
+			{"type": "function_call_output", "call_id": "call_1", "output": "sunny"}
+		]
+	}`)
+
+	output := ConvertOpenAIResponsesRequestToCodex("gpt-5.2", inputJSON, false)
+
+	if got := gjson.GetBytes(output, "input.1").Raw; got != reasoning {
+		t.Errorf("Expected reasoning item to be forwarded intact\nexpected: %s\ngot:      %s", reasoning, got)
+	}
+	if got := gjson.GetBytes(output, "include").Raw; !strings.Contains(got, "reasoning.encrypted_content") {
+		t.Errorf("Expected include to request encrypted reasoning content, got %s", got)
+	}
+}
+
+// TestResponseFormatNormalizedToTextFormat tests that a Chat Completions style response_format is
+// moved to text.format and that an explicit text.format wins
+func TestResponseFormatNormalizedToTextFormat(t *testing.T) {
+	inputJSON := []byte(`{
+		"model": "gpt-5.2",
+		"input": "Describe a cat",
+		"response_format": {"type": "json_schema", "json_schema": {"name": "cat", "strict": true, "schema": {"type": "object"}}}
+	}`)
+
+	output := ConvertOpenAIResponsesRequestToCodex("gpt-5.2", inputJSON, false)
+	if gjson.GetBytes(output, "response_format").Exists() {
+		t.Errorf("Expected response_format to be removed, got %s", output)
+	}
+	expected := `{"type":"json_schema","name":"cat","strict":true,"schema":{"type":"object"}}`
+	if got := gjson.GetBytes(output, "text.format").Raw; !jsonEqualForTest(got, expected) {
+		t.Errorf("Expected text.format %s, got %s", expected, got)
+	}
+
+	explicit := []byte(`{
+		"model": "gpt-5.2",
+		"input": "Describe a cat",
+		"text": {"format": {"type": "text"}},
+		"response_format": {"type": "json_object"}
+	}`)
+	output = ConvertOpenAIResponsesRequestToCodex("gpt-5.2", explicit, false)
+	if got := gjson.GetBytes(output, "text.format.type").String(); got != "text" {
+		t.Errorf("Expected explicit text.format to win, got %q", got)
+	}
+	if gjson.GetBytes(output, "response_format").Exists() {
+		t.Errorf("Expected response_format to be removed, got %s", output)
+	}
+}
+
+// TestNullOptionalFields tests that explicitly null optional fields are dropped instead of being
+// forwarded or rejected
+func TestNullOptionalFields(t *testing.T) {
+	inputJSON := []byte(`{
+		"model": "gpt-5.2",
+		"input": "Hi",
+		"tool_choice": null,
+		"truncation": null,
+		"max_tool_calls": null,
+		"reasoning": {"effort": null}
+	}`)
+
+	output, err := ConvertOpenAIResponsesRequestToCodexE("gpt-5.2", inputJSON, false)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	for _, field := range []string{"tool_choice", "truncation", "max_tool_calls"} {
+		if gjson.GetBytes(output, field).Exists() {
+			t.Errorf("Expected %s to be dropped, got %s", field, output)
+		}
+	}
+	if got := gjson.GetBytes(output, "reasoning.effort").String(); got != "medium" {
+		t.Errorf("Expected default reasoning effort medium, got %q", got)
+	}
+}
+
+// TestInstructionsPrefix tests that the prefix is prepended once, including for instructions
+// replayed from an earlier turn
+func TestInstructionsPrefix(t *testing.T) {
+	const prefix = "You are Codex, a coding agent."
+	opts := Options{InstructionsPrefix: prefix}
+
+	output, err := ConvertOpenAIResponsesRequestToCodexWithOptions("gpt-5.2", []byte(`{"model":"gpt-5.2","instructions":"Be brief.","input":"Hi"}`), false, opts)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	prefixed := gjson.GetBytes(output, "instructions").String()
+	if prefixed != prefix+"\n\nBe brief." {
+		t.Errorf("Expected the prefix ahead of the instructions, got %q", prefixed)
+	}
+
+	replay, _ := sjson.SetBytes([]byte(`{"model":"gpt-5.2","input":"Again"}`), "instructions", prefixed)
+	output, err = ConvertOpenAIResponsesRequestToCodexWithOptions("gpt-5.2", replay, false, opts)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if got := gjson.GetBytes(output, "instructions").String(); got != prefixed {
+		t.Errorf("Expected replayed instructions to stay unchanged, got %q", got)
+	}
+}
+
+// TestDefaultReasoningEffortPerModel tests that models get their configured default effort
+func TestDefaultReasoningEffortPerModel(t *testing.T) {
+	opts := Options{DefaultReasoningEfforts: map[string]string{"gpt-5.2-mini": "low"}}
+	for model, want := range map[string]string{"gpt-5.2-mini": "low", "gpt-5.2": "medium"} {
+		output, err := ConvertOpenAIResponsesRequestToCodexWithOptions(model, []byte(`{"input":"Hi"}`), false, opts)
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		if got := gjson.GetBytes(output, "reasoning.effort").String(); got != want {
+			t.Errorf("Expected effort %q for %s, got %q", want, model, got)
+		}
+	}
+}
+
+// TestAnnotationsPreservedOnContentParts tests that annotations on assistant and developer text
+// parts survive the conversion
+func TestAnnotationsPreservedOnContentParts(t *testing.T) {
+	annotations := `[{"type":"url_citation","start_index":0,"end_index":5,"url":"https://example.com","title":"Example"}]`
+	inputJSON := []byte(`{
+		"model": "gpt-5.2",
+		"input": [
+			{"type": "message", "role": "developer", "content": [{"type": "input_text", "text": "Cite sources", "annotations": ` + annotations + `}]},
+			{"type": "message", "role": "user", "content": [{"type": "input_text", "text": "Hi"}]},
+			{"type": "message", "role": "assistant", "content": [{"type": "text", "text": "Hello", "annotations": ` + annotations + `}]}
+		]
+	}`)
+
+	output := ConvertOpenAIResponsesRequestToCodex("gpt-5.2", inputJSON, false)
+
+	for _, index := range []int{0, 2} {
+		part := gjson.GetBytes(output, fmt.Sprintf("input.%d.content.0", index))
+		if got := part.Get("annotations").Raw; !jsonEqualForTest(got, annotations) {
+			t.Errorf("Expected annotations on input %d to survive, got %s", index, part.Raw)
+		}
+	}
+	if got := gjson.GetBytes(output, "input.2.content.0.type").String(); got != "output_text" {
+		t.Errorf("Expected the assistant part to be retyped to output_text, got %q", got)
+	}
+}
+
+// TestMaxImageBytes tests that inline images under the limit pass, and oversized ones are dropped or
+// reported depending on the strategy
+func TestMaxImageBytes(t *testing.T) {
+	small := "data:image/png;base64," + strings.Repeat("A", 8)
+	large := "data:image/png;base64," + strings.Repeat("A", 400)
+	build := func(url string) []byte {
+		return []byte(`{"model":"gpt-5.2","input":[{"type":"message","role":"user","content":[{"type":"input_text","text":"Look"},{"type":"input_image","image_url":"` + url + `"}]}]}`)
+	}
+
+	output, err := ConvertOpenAIResponsesRequestToCodexWithOptions("gpt-5.2", build(small), false, Options{MaxImageBytes: 100})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if got := gjson.GetBytes(output, "input.0.content.#").Int(); got != 2 {
+		t.Errorf("Expected the small image to be kept, got %s", gjson.GetBytes(output, "input.0.content").Raw)
+	}
+
+	output, err = ConvertOpenAIResponsesRequestToCodexWithOptions("gpt-5.2", build(large), false, Options{MaxImageBytes: 100, DropOversizedImages: true})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	parts := gjson.GetBytes(output, "input.0.content").Array()
+	if len(parts) != 1 || parts[0].Get("type").String() != "input_text" {
+		t.Errorf("Expected the large image to be dropped, got %s", gjson.GetBytes(output, "input.0.content").Raw)
+	}
+
+	if _, err = ConvertOpenAIResponsesRequestToCodexWithOptions("gpt-5.2", build(large), false, Options{MaxImageBytes: 100}); err == nil || !strings.Contains(err.Error(), "limit of 100") {
+		t.Errorf("Expected the large image to be reported, got %v", err)
+	}
+}
+
+// TestMaxImageBytesFunctionCallOutput tests that the image limit applies to function_call_output
+// image arrays
+func TestMaxImageBytesFunctionCallOutput(t *testing.T) {
+	large := "data:image/png;base64," + strings.Repeat("A", 400)
+	inputJSON := []byte(`{"model":"gpt-5.2","input":[
+		{"type":"function_call","call_id":"call_1","name":"screenshot","arguments":"{}"},
+		{"type":"function_call_output","call_id":"call_1","output":[{"type":"input_text","text":"Captured"},{"type":"input_image","image_url":"` + large + `"}]}
+	]}`)
+
+	output, err := ConvertOpenAIResponsesRequestToCodexWithOptions("gpt-5.2", inputJSON, false, Options{MaxImageBytes: 100, DropOversizedImages: true})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	result := gjson.GetBytes(output, "input.1.output")
+	if len(result.Array()) != 1 || result.Get("0.type").String() != "input_text" {
+		t.Errorf("Expected the large image to be dropped from the output, got %s", result.Raw)
+	}
+
+	if _, err = ConvertOpenAIResponsesRequestToCodexWithOptions("gpt-5.2", inputJSON, false, Options{MaxImageBytes: 100}); err == nil || !strings.Contains(err.Error(), "input[1].output[1]") {
+		t.Errorf("Expected the large output image to be reported, got %v", err)
+	}
+}
+
+// TestIntegerReasoningEffort tests that integer effort levels are mapped to effort names
+func TestIntegerReasoningEffort(t *testing.T) {
+	output, err := ConvertOpenAIResponsesRequestToCodexE("gpt-5.2", []byte(`{"input":"Hi","reasoning":{"effort":0}}`), false)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if got := gjson.GetBytes(output, "reasoning.effort").String(); got != "minimal" {
+		t.Errorf("Expected effort minimal for level 0, got %q", got)
+	}
+
+	if _, err := ConvertOpenAIResponsesRequestToCodexE("gpt-5.2", []byte(`{"input":"Hi","reasoning":{"effort":9}}`), false); err == nil {
+		t.Error("Expected level 9 to be rejected")
+	}
+}
+
+// jsonEqualForTest compares two JSON documents ignoring whitespace and key order.
+func jsonEqualForTest(a, b string) bool {
+	var av, bv any
+	if json.Unmarshal([]byte(a), &av) != nil || json.Unmarshal([]byte(b), &bv) != nil {
+		return false
+	}
+	return reflect.DeepEqual(av, bv)
+}
+
+// FuzzConvertOpenAIResponsesRequestToCodex feeds arbitrary bytes to the translator and checks that
+// it never panics and that the strict variant either rejects the input or produces valid JSON
+func FuzzConvertOpenAIResponsesRequestToCodex(f *testing.F) {
+	f.Add([]byte(`{"model":"gpt-5.2","input":"hi"}`))
+	f.Add([]byte(`{"input":[{"type":"message","role":" System","content":[{"type":"input_image","image_url":{"url":"u","detail":"low"}}]}]}`))
+	f.Add([]byte(`{"input":[{"type":"function_call","call_id":"","name":"f"},{"type":"function_call_output","call_id":""}]}`))
+	f.Add([]byte(`{"input":{"role":"user"},"max_output_tokens":1,"user":"u"}`))
+	f.Add([]byte(`{"input":[`))
+	f.Add([]byte(`"input"`))
+	f.Add([]byte(``))
+
+	f.Fuzz(func(t *testing.T, data []byte) {
+		_ = ConvertOpenAIResponsesRequestToCodex("gpt-5.2", append([]byte(nil), data...), true)
+		out, err := ConvertOpenAIResponsesRequestToCodexE("gpt-5.2", append([]byte(nil), data...), true)
+		if err == nil && !gjson.ValidBytes(out) {
+			t.Fatalf("Expected valid JSON output for input %q, got %q", data, out)
+		}
+	})
+}
+
+// TestConvertOpenAIResponsesRequestToCodex_ZeroMaxOutputTokens tests that max_output_tokens of
+// zero is not forwarded
+func TestConvertOpenAIResponsesRequestToCodex_ZeroMaxOutputTokens(t *testing.T) {
+	inputJSON := []byte(`{"model":"gpt-5.2","input":"Hello","max_output_tokens":0}`)
+
+	output := ConvertOpenAIResponsesRequestToCodex("gpt-5.2", inputJSON, false)
+	if gjson.GetBytes(output, "max_output_tokens").Exists() {
+		t.Errorf("Expected max_output_tokens of 0 to be omitted, got %s", output)
+	}
+}
@@ -22,6 +22,7 @@ func ConvertCodexResponseToOpenAIResponses(ctx context.Context, modelName string
 					instructions := gjson.GetBytes(originalRequestRawJSON, "instructions").String()
 					rawJSON, _ = sjson.SetBytes(rawJSON, "response.instructions", instructions)
 				}
+				rawJSON = stripForcedFields(rawJSON, "response.", originalRequestRawJSON)
 			}
 		}
 		out := fmt.Sprintf("data: %s", string(rawJSON))
@@ -44,5 +45,26 @@ func ConvertCodexResponseToOpenAIResponsesNonStream(_ context.Context, modelName
 		instructions := gjson.GetBytes(originalRequestRawJSON, "instructions").String()
 		template, _ = sjson.Set(template, "instructions", instructions)
 	}
-	return template
+	return string(stripForcedFields([]byte(template), "", originalRequestRawJSON))
+}
+
+// forcedRequestFields lists the fields the request translator always sets for Codex. Codex
+// echoes them back in the response object, which would surprise clients that never sent them.
+// parallel_tool_calls is forced too but is a required field of the Response object, so it is
+// kept and reflects the client's own value instead.
+var forcedRequestFields = []string{"store", "include"}
+
+// stripForcedFields removes echoed forced fields under prefix unless the client's original
+// request carried them, and echoes the client's parallel_tool_calls when it sent one.
+func stripForcedFields(rawJSON []byte, prefix string, originalRequestRawJSON []byte) []byte {
+	for _, field := range forcedRequestFields {
+		if gjson.GetBytes(originalRequestRawJSON, field).Exists() || !gjson.GetBytes(rawJSON, prefix+field).Exists() {
+			continue
+		}
+		rawJSON, _ = sjson.DeleteBytes(rawJSON, prefix+field)
+	}
+	if parallel := gjson.GetBytes(originalRequestRawJSON, "parallel_tool_calls"); parallel.IsBool() && gjson.GetBytes(rawJSON, prefix+"parallel_tool_calls").Exists() {
+		rawJSON, _ = sjson.SetBytes(rawJSON, prefix+"parallel_tool_calls", parallel.Bool())
+	}
+	return rawJSON
 }
@@ -0,0 +1,52 @@
+package responses
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/tidwall/gjson"
+)
+
+// TestConvertCodexResponseToOpenAIResponses_ForcedFieldsNotEchoed tests that store and include
+// forced by the request translator are only echoed when the client sent them, while the required
+// parallel_tool_calls is always kept and carries the client's value
+func TestConvertCodexResponseToOpenAIResponses_ForcedFieldsNotEchoed(t *testing.T) {
+	completed := `{"type":"response.completed","response":{"id":"resp_1","status":"completed","store":false,"include":["reasoning.encrypted_content"],"parallel_tool_calls":true,"output":[]}}`
+	original := []byte(`{"model":"gpt-5.2","input":"Hello"}`)
+
+	lines := ConvertCodexResponseToOpenAIResponses(context.Background(), "gpt-5.2", original, nil, []byte("data: "+completed), nil)
+	if len(lines) != 1 {
+		t.Fatalf("Expected 1 line, got %d", len(lines))
+	}
+	event := []byte(strings.TrimPrefix(lines[0], "data: "))
+	if gjson.GetBytes(event, "response.store").Exists() {
+		t.Error("Expected response.store not to be echoed")
+	}
+	if gjson.GetBytes(event, "response.include").Exists() {
+		t.Error("Expected response.include not to be echoed")
+	}
+	if !gjson.GetBytes(event, "response.parallel_tool_calls").Exists() {
+		t.Error("Expected the required response.parallel_tool_calls to be kept")
+	}
+	if got := gjson.GetBytes(event, "response.id").String(); got != "resp_1" {
+		t.Errorf("Expected response.id 'resp_1', got %q", got)
+	}
+
+	nonStream := ConvertCodexResponseToOpenAIResponsesNonStream(context.Background(), "gpt-5.2", original, nil, []byte(completed), nil)
+	if gjson.Get(nonStream, "store").Exists() || gjson.Get(nonStream, "include").Exists() {
+		t.Errorf("Expected forced fields to be stripped from the non-stream response, got %s", nonStream)
+	}
+	if !gjson.Get(nonStream, "parallel_tool_calls").Exists() {
+		t.Errorf("Expected parallel_tool_calls to be kept, got %s", nonStream)
+	}
+
+	requested := []byte(`{"model":"gpt-5.2","input":"Hello","parallel_tool_calls":false}`)
+	nonStream = ConvertCodexResponseToOpenAIResponsesNonStream(context.Background(), "gpt-5.2", requested, nil, []byte(completed), nil)
+	if got := gjson.Get(nonStream, "parallel_tool_calls"); !got.Exists() || got.Bool() {
+		t.Errorf("Expected the client's parallel_tool_calls false to be echoed, got %s", nonStream)
+	}
+	if gjson.Get(nonStream, "store").Exists() {
+		t.Errorf("Expected store not to be echoed, got %s", nonStream)
+	}
+}
@@ -0,0 +1,110 @@
+package responses
+
+import (
+	"strings"
+
+	"github.com/tidwall/gjson"
+	"github.com/tidwall/sjson"
+)
+
+// EstimateTokens returns a rough token count for text using the common heuristic of about four
+// bytes per token. It is intended for budgeting decisions, not for billing.
+func EstimateTokens(text string) int {
+	if text == "" {
+		return 0
+	}
+	return (len(text) + 3) / 4
+}
+
+// TruncateToTokenBudget drops the oldest conversation turns from a Responses request until the
+// estimated size of its input items fits within maxTokens. Leading system and developer messages
+// are always kept, as is the most recent turn. A turn starts at a user message and only ends once
+// every function_call in it has its function_call_output, so call/output pairs are never split.
+//
+// Parameters:
+//   - rawJSON: The Responses request JSON
+//   - maxTokens: The token budget for the input items; values <= 0 disable trimming
+//
+// Returns:
+//   - []byte: The request with the trimmed input, or rawJSON unchanged when nothing is dropped
+func TruncateToTokenBudget(rawJSON []byte, maxTokens int) []byte {
+	input := gjson.GetBytes(rawJSON, "input")
+	if maxTokens <= 0 || !input.IsArray() {
+		return rawJSON
+	}
+
+	items := input.Array()
+	prefix := 0
+	for prefix < len(items) && isInstructionMessage(items[prefix]) {
+		prefix++
+	}
+
+	budget := maxTokens
+	for _, item := range items[:prefix] {
+		budget -= EstimateTokens(item.Raw)
+	}
+
+	// Split the remaining items into turns that can be dropped as a whole.
+	var turns [][]gjson.Result
+	pendingCalls := map[string]struct{}{}
+	for _, item := range items[prefix:] {
+		startsTurn := item.Get("type").String() == "message" && strings.EqualFold(item.Get("role").String(), "user") && len(pendingCalls) == 0
+		if startsTurn || len(turns) == 0 {
+			turns = append(turns, nil)
+		}
+		turns[len(turns)-1] = append(turns[len(turns)-1], item)
+		switch item.Get("type").String() {
+		case "function_call":
+			pendingCalls[item.Get("call_id").String()] = struct{}{}
+		case "function_call_output":
+			delete(pendingCalls, item.Get("call_id").String())
+		}
+	}
+
+	costs := make([]int, len(turns))
+	total := 0
+	for i, turn := range turns {
+		for _, item := range turn {
+			costs[i] += EstimateTokens(item.Raw)
+		}
+		total += costs[i]
+	}
+
+	dropped := 0
+	for dropped < len(turns)-1 && total > budget {
+		total -= costs[dropped]
+		dropped++
+	}
+	if dropped == 0 {
+		return rawJSON
+	}
+
+	var b strings.Builder
+	b.WriteByte('[')
+	kept := append([]gjson.Result(nil), items[:prefix]...)
+	for _, turn := range turns[dropped:] {
+		kept = append(kept, turn...)
+	}
+	for i, item := range kept {
+		if i > 0 {
+			b.WriteByte(',')
+		}
+		b.WriteString(item.Raw)
+	}
+	b.WriteByte(']')
+
+	out, err := sjson.SetRawBytes(append([]byte(nil), rawJSON...), "input", []byte(b.String()))
+	if err != nil {
+		return rawJSON
+	}
+	return out
+}
+
+// isInstructionMessage reports whether item is a system or developer message.
+func isInstructionMessage(item gjson.Result) bool {
+	if item.Get("type").Exists() && item.Get("type").String() != "message" {
+		return false
+	}
+	role := strings.ToLower(strings.TrimSpace(item.Get("role").String()))
+	return role == "system" || role == "developer"
+}
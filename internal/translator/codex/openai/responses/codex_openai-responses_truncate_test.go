@@ -0,0 +1,82 @@
+package responses
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/tidwall/gjson"
+)
+
+// TestEstimateTokens tests the four-bytes-per-token heuristic
+func TestEstimateTokens(t *testing.T) {
+	cases := map[string]int{
+		"":          0,
+		"abc":       1,
+		"abcd":      1,
+		"abcde":     2,
+		"abcdefghi": 3,
+	}
+	for text, want := range cases {
+		if got := EstimateTokens(text); got != want {
+			t.Errorf("EstimateTokens(%q): expected %d, got %d", text, want, got)
+		}
+	}
+}
+
+// TestTruncateToTokenBudget_KeepsSystemPrefixAndPairs tests that the oldest turns are dropped
+// while the leading system messages and function call/output pairs survive intact
+func TestTruncateToTokenBudget_KeepsSystemPrefixAndPairs(t *testing.T) {
+	filler := strings.Repeat("x", 400)
+	inputJSON := []byte(`{
+		"model": "gpt-5.2",
+		"input": [
+			{"type": "message", "role": "system", "content": [{"type": "input_text", "text": "Be brief."}]},
+			{"type": "message", "role": "developer", "content": [{"type": "input_text", "text": "Use metric units."}]},
+			{"type": "message", "role": "user", "content": [{"type": "input_text", "text": "old ` + filler + `"}]},
+			{"type": "message", "role": "assistant", "content": [{"type": "output_text", "text": "old answer ` + filler + `"}]},
+			{"type": "message", "role": "user", "content": [{"type": "input_text", "text": "Weather?"}]},
+			{"type": "function_call", "call_id": "call_1", "name": "get_weather", "arguments": "{}"},
+			{"type": "message", "role": "user", "content": [{"type": "input_text", "text": "Paris please"}]},
+			{"type": "function_call_output", "call_id": "call_1", "output": "sunny"},
+			{"type": "message", "role": "user", "content": [{"type": "input_text", "text": "Thanks"}]}
+		]
+	}`)
+
+	full := 0
+	for _, item := range gjson.GetBytes(inputJSON, "input").Array() {
+		full += EstimateTokens(item.Raw)
+	}
+	if got := TruncateToTokenBudget(inputJSON, full); string(got) != string(inputJSON) {
+		t.Errorf("Expected request within budget to be returned unchanged")
+	}
+
+	output := TruncateToTokenBudget(inputJSON, full-200)
+	input := gjson.GetBytes(output, "input").Array()
+	expected := []string{"Be brief.", "Use metric units.", "Weather?", "", "Paris please", "", "Thanks"}
+	if len(input) != len(expected) {
+		t.Fatalf("Expected %d input items after trimming, got %d: %s", len(expected), len(input), gjson.GetBytes(output, "input").Raw)
+	}
+	for i, want := range expected {
+		if want == "" {
+			continue
+		}
+		if got := input[i].Get("content.0.text").String(); got != want {
+			t.Errorf("Expected input[%d] text %q, got %q", i, want, got)
+		}
+	}
+	if input[3].Get("type").String() != "function_call" || input[5].Get("type").String() != "function_call_output" {
+		t.Errorf("Expected the function call/output pair to be kept together, got %s", gjson.GetBytes(output, "input").Raw)
+	}
+
+	minimal := TruncateToTokenBudget(inputJSON, 1)
+	input = gjson.GetBytes(minimal, "input").Array()
+	if len(input) != 3 {
+		t.Fatalf("Expected the system prefix and last turn to remain, got %s", gjson.GetBytes(minimal, "input").Raw)
+	}
+	if got := input[2].Get("content.0.text").String(); got != "Thanks" {
+		t.Errorf("Expected the most recent turn to be kept, got %q", got)
+	}
+	if got := gjson.GetBytes(inputJSON, "input.2.content.0.text").String(); !strings.HasPrefix(got, "old ") {
+		t.Errorf("Expected the original request to be left untouched, got %q", got)
+	}
+}
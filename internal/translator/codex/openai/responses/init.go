@@ -16,4 +16,5 @@ func init() {
 			NonStream: ConvertCodexResponseToOpenAIResponsesNonStream,
 		},
 	)
+	translator.RegisterRequestTranslator(OpenaiResponse, Codex, translator.RequestTranslatorFunc(ConvertOpenAIResponsesRequestToCodexE))
 }
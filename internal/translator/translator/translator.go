@@ -6,6 +6,7 @@ package translator
 
 import (
 	"context"
+	"sync"
 
 	"github.com/router-for-me/CLIProxyAPI/v6/internal/interfaces"
 	sdktranslator "github.com/router-for-me/CLIProxyAPI/v6/sdk/translator"
@@ -25,6 +26,72 @@ func Register(from, to string, request interfaces.TranslateRequestFunc, response
 	registry.Register(sdktranslator.FromString(from), sdktranslator.FromString(to), request, response)
 }
 
+// RequestTranslator converts a request from one API format to another and reports
+// requests that cannot be translated faithfully.
+type RequestTranslator interface {
+	Convert(modelName string, rawJSON []byte, stream bool) ([]byte, error)
+}
+
+// RequestTranslatorFunc adapts a plain function to the RequestTranslator interface.
+type RequestTranslatorFunc func(modelName string, rawJSON []byte, stream bool) ([]byte, error)
+
+// Convert calls f(modelName, rawJSON, stream).
+func (f RequestTranslatorFunc) Convert(modelName string, rawJSON []byte, stream bool) ([]byte, error) {
+	return f(modelName, rawJSON, stream)
+}
+
+var (
+	requestTranslatorsMu sync.RWMutex
+	requestTranslators   = make(map[sdktranslator.Format]map[sdktranslator.Format]RequestTranslator)
+)
+
+// RegisterRequestTranslator registers an error-reporting request translator between two
+// API formats. It takes precedence over the request function passed to Register.
+//
+// Parameters:
+//   - from: The source API format identifier
+//   - to: The target API format identifier
+//   - t: The request translator
+func RegisterRequestTranslator(from, to string, t RequestTranslator) {
+	requestTranslatorsMu.Lock()
+	defer requestTranslatorsMu.Unlock()
+
+	source := sdktranslator.FromString(from)
+	if _, ok := requestTranslators[source]; !ok {
+		requestTranslators[source] = make(map[sdktranslator.Format]RequestTranslator)
+	}
+	requestTranslators[source][sdktranslator.FromString(to)] = t
+}
+
+// Get returns the request translator for a source and target API format. Pairs registered
+// only through Register are wrapped so that they never report an error.
+//
+// Parameters:
+//   - from: The source API format identifier
+//   - to: The target API format identifier
+//
+// Returns:
+//   - RequestTranslator: The translator for the pair
+//   - bool: False if no translator is registered for the pair
+func Get(from, to string) (RequestTranslator, bool) {
+	source, target := sdktranslator.FromString(from), sdktranslator.FromString(to)
+
+	requestTranslatorsMu.RLock()
+	t, ok := requestTranslators[source][target]
+	requestTranslatorsMu.RUnlock()
+	if ok {
+		return t, true
+	}
+
+	fn, ok := registry.RequestTransformer(source, target)
+	if !ok {
+		return nil, false
+	}
+	return RequestTranslatorFunc(func(modelName string, rawJSON []byte, stream bool) ([]byte, error) {
+		return fn(modelName, rawJSON, stream), nil
+	}), true
+}
+
 // Request translates a request from one API format to another.
 //
 // Parameters:
@@ -0,0 +1,60 @@
+package translator_test
+
+import (
+	"testing"
+
+	. "github.com/router-for-me/CLIProxyAPI/v6/internal/constant"
+	_ "github.com/router-for-me/CLIProxyAPI/v6/internal/translator"
+	"github.com/router-for-me/CLIProxyAPI/v6/internal/translator/translator"
+	"github.com/tidwall/gjson"
+)
+
+// TestGet_RegisteredPairs tests that every Codex request translator can be looked up and used
+func TestGet_RegisteredPairs(t *testing.T) {
+	cases := []struct {
+		from    string
+		request string
+	}{
+		{OpenAI, `{"model":"gpt-5.2","messages":[{"role":"user","content":"Hello"}]}`},
+		{OpenaiResponse, `{"model":"gpt-5.2","input":"Hello"}`},
+		{Claude, `{"model":"gpt-5.2","messages":[{"role":"user","content":"Hello"}]}`},
+		{Gemini, `{"contents":[{"role":"user","parts":[{"text":"Hello"}]}]}`},
+	}
+
+	for _, tc := range cases {
+		rt, ok := translator.Get(tc.from, Codex)
+		if !ok {
+			t.Errorf("Expected a translator for %s -> %s", tc.from, Codex)
+			continue
+		}
+		out, err := rt.Convert("gpt-5.2", []byte(tc.request), true)
+		if err != nil {
+			t.Errorf("%s -> %s: expected no error, got: %v", tc.from, Codex, err)
+			continue
+		}
+		if got := gjson.GetBytes(out, "model").String(); got != "gpt-5.2" {
+			t.Errorf("%s -> %s: expected model 'gpt-5.2', got %q", tc.from, Codex, got)
+		}
+	}
+}
+
+// TestGet_StrictTranslatorReportsErrors tests that pairs with a strict converter surface errors
+func TestGet_StrictTranslatorReportsErrors(t *testing.T) {
+	rt, ok := translator.Get(OpenaiResponse, Codex)
+	if !ok {
+		t.Fatalf("Expected a translator for %s -> %s", OpenaiResponse, Codex)
+	}
+	if _, err := rt.Convert("gpt-5.2", []byte(`[]`), false); err == nil {
+		t.Error("Expected an error for a non-object request, got nil")
+	}
+}
+
+// TestGet_Miss tests that unknown format pairs are reported as missing
+func TestGet_Miss(t *testing.T) {
+	if rt, ok := translator.Get("unknown-format", Codex); ok || rt != nil {
+		t.Errorf("Expected no translator for unknown-format -> %s, got %v", Codex, rt)
+	}
+	if _, ok := translator.Get(Codex, "unknown-format"); ok {
+		t.Errorf("Expected no translator for %s -> unknown-format", Codex)
+	}
+}